@@ -6,38 +6,81 @@ package configuration
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
+	"strings"
 )
 
 var Global = Default()
 
 type Configuration struct {
-	RangePow       []int
-	K              []int
-	L              []int
-	Sparsity       []float64
-	BatchSize      int
-	Rehash         int
-	Rebuild        int
-	InputDim       int
-	TotRecords     int
-	TotRecordsTest int
-	LearningRate   float64
-	Epoch          int
-	Stepsize       int
-	SizesOfLayers  []int
-	NumLayer       int
-	TrainData      string
-	TestData       string
-	Weights        string
-	SavedWeights   string
-	LogFile        string
-	UseAdam        bool
-	HashFunction   HashFunctionType
-	LoadWeight     bool
-	LayerMode      LayerModeType
-	CpuProfile     bool
-	MemProfile     bool
+	RangePow           []int
+	K                  []int
+	L                  []int
+	Sparsity           []float64
+	BatchSize          int
+	Rehash             int
+	Rebuild            int
+	InputDim           int
+	TotRecords         int
+	TotRecordsTest     int
+	LearningRate       float64
+	Schedule           ScheduleType
+	DecayRate          float64
+	DecaySteps         int
+	MinLearningRate    float64
+	WarmupSteps        int
+	Patience           int
+	Epoch              int
+	Stepsize           int
+	SizesOfLayers      []int
+	NumLayer           int
+	TrainData          DataFiles
+	TestData           DataFiles
+	DataFormat         DataFormatType
+	ShardHeader        ShardHeaderType
+	IndexBase          int
+	BinaryLabels       bool
+	InferDimensions    bool
+	PrefetchBatches    int
+	Shuffle            ShuffleType
+	ShuffleBufferSize  int
+	Seed               int64
+	LenientParsing     bool
+	MaxErrorRate       float64
+	QuarantineFile     string
+	Weights            string
+	SavedWeights       string
+	LogFile            string
+	Optimizer          OptimizerType
+	Momentum           float64
+	Beta1              float64
+	Beta2              float64
+	Epsilon            float64
+	Rho                float64
+	WeightDecay        float64
+	SparseUpdates      bool
+	L2Regularization   []float64
+	MaxNorm            []float64
+	Dropout            []float64
+	InputDropout       float64
+	GradientClipping   GradientClippingType
+	MaxGradientNorm    float64
+	NanPolicy          NanPolicyType
+	NanDecayRate       float64
+	CheckpointInterval int
+	Quantization       QuantizationType
+	MetricsK           []int
+	PropensityA        float64
+	PropensityB        float64
+	ExactPrediction    bool
+	PredictionsFile    string
+	PredictionsTopK    int
+	HashFunction       HashFunctionType
+	LoadWeight         bool
+	LayerMode          LayerModeType
+	CpuProfile         bool
+	MemProfile         bool
 }
 
 type HashFunctionType int8
@@ -49,6 +92,132 @@ const (
 	SparseRandomProjectionHashFunction
 )
 
+// DataFormatType defines the format of the training and test data.
+type DataFormatType int8
+
+const (
+	// XCRepoDataFormat is the sparse format of The Extreme
+	// Classification Repository.
+	XCRepoDataFormat DataFormatType = iota + 1
+	// LibSVMDataFormat is the LibSVM / SVMlight sparse format, with
+	// feature indices starting from IndexBase. The dimensions are
+	// inferred from the data if InferDimensions is set, otherwise
+	// they are InputDim and the size of the last layer, or inferred
+	// if omitted. If BinaryLabels is set, the labels are the -1 and
+	// +1 of binary classification, read as 0 and 1.
+	LibSVMDataFormat
+	// CSRDataFormat is the memory-mapped binary format of package
+	// dataset/csr, created with the convert command.
+	CSRDataFormat
+)
+
+// DataFiles are the files of a dataset, or glob patterns matching them,
+// which are read in sequence as shards of the dataset. Files compressed
+// with gzip or bzip2 are decompressed. In JSON, it is either a string
+// or an array of strings.
+type DataFiles []string
+
+func (d *DataFiles) UnmarshalJSON(data []byte) error {
+	var file string
+	if err := json.Unmarshal(data, &file); err == nil {
+		*d = DataFiles{}
+		if file != "" {
+			*d = append(*d, file)
+		}
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(d))
+}
+
+func (d DataFiles) String() string {
+	return strings.Join(d, ", ")
+}
+
+// ShardHeaderType defines where the header of a dataset in the XCRepo
+// format split in several shards is.
+type ShardHeaderType int8
+
+const (
+	// GlobalShardHeader is a single header, at the start of the first
+	// shard, for the whole dataset.
+	GlobalShardHeader ShardHeaderType = iota + 1
+	// PerShardHeader is a header at the start of each shard, for the
+	// points of the shard. The dimensions must be the same.
+	PerShardHeader
+)
+
+// ShuffleType defines how the training examples are shuffled at each
+// epoch, using Seed, or a seed drawn from the current time if zero.
+type ShuffleType int8
+
+const (
+	NoShuffle ShuffleType = iota + 1
+	// PermutationShuffle draws a permutation of all the examples, which
+	// are loaded in memory, unless the data format allows random access.
+	PermutationShuffle
+	// BufferShuffle draws each example at random from a buffer of the
+	// next ShuffleBufferSize examples.
+	BufferShuffle
+)
+
+type ScheduleType int8
+
+const (
+	ConstantSchedule ScheduleType = iota + 1
+	StepDecaySchedule
+	ExponentialSchedule
+	CosineAnnealingSchedule // uses DecaySteps as period
+	ReduceOnPlateauSchedule // uses Patience and DecayRate
+)
+
+type OptimizerType int8
+
+const (
+	SgdOptimizer OptimizerType = iota + 1
+	MomentumOptimizer
+	AdaGradOptimizer
+	RmsPropOptimizer
+	AdamOptimizer
+	AdamWOptimizer // uses WeightDecay as decoupled weight decay
+)
+
+type GradientClippingType int8
+
+const (
+	NoGradientClipping     GradientClippingType = iota + 1
+	NodeGradientClipping                        // clips the gradients of each node separately
+	GlobalGradientClipping                      // clips the gradients of the whole network
+)
+
+// NanPolicyType defines what happens when NaN or infinite values are
+// found in the activations, or would result from the parameter updates,
+// during training. The policies other than IgnoreNan check the
+// activations and dry-run the parameter updates of each batch, which
+// slows down training.
+type NanPolicyType int8
+
+const (
+	IgnoreNan NanPolicyType = iota + 1
+	// SkipBatchOnNan discards the gradients of the batch.
+	SkipBatchOnNan
+	// ReduceLearningRateOnNan discards the gradients of the batch, and
+	// multiplies the learning rate by NanDecayRate.
+	ReduceLearningRateOnNan
+	// RollbackOnNan restores the parameters saved in the last
+	// checkpoint, taken in memory every CheckpointInterval batches.
+	RollbackOnNan
+)
+
+// QuantizationType defines the quantized weights representation
+// evaluated against the full-precision model after training.
+type QuantizationType int8
+
+const (
+	NoQuantization       QuantizationType = iota + 1
+	Bfloat16Quantization                  // bfloat16 weights
+	Int8Quantization                      // int8 weights, scaled per neuron
+)
+
 type LayerModeType int8
 
 const ( // TODO: find meaningful names
@@ -60,32 +229,73 @@ const ( // TODO: find meaningful names
 
 func Default() *Configuration {
 	return &Configuration{
-		RangePow:       make([]int, 0),
-		K:              make([]int, 0),
-		L:              make([]int, 0),
-		Sparsity:       make([]float64, 0),
-		BatchSize:      1000,
-		Rehash:         1000,
-		Rebuild:        1000,
-		InputDim:       784,
-		TotRecords:     60000,
-		TotRecordsTest: 10000,
-		LearningRate:   0.0001,
-		Epoch:          5,
-		Stepsize:       20,
-		SizesOfLayers:  make([]int, 0),
-		NumLayer:       3,
-		TrainData:      "",
-		TestData:       "",
-		Weights:        "",
-		SavedWeights:   "",
-		LogFile:        "",
-		UseAdam:        true,
-		HashFunction:   DensifiedWtaHashFunction,
-		LoadWeight:     false,
-		LayerMode:      LayerMode4,
-		CpuProfile:     false,
-		MemProfile:     false,
+		RangePow:           make([]int, 0),
+		K:                  make([]int, 0),
+		L:                  make([]int, 0),
+		Sparsity:           make([]float64, 0),
+		BatchSize:          1000,
+		Rehash:             1000,
+		Rebuild:            1000,
+		InputDim:           0,
+		TotRecords:         0,
+		TotRecordsTest:     0,
+		LearningRate:       0.0001,
+		Schedule:           ConstantSchedule,
+		DecayRate:          0.5,
+		DecaySteps:         10000,
+		MinLearningRate:    0,
+		WarmupSteps:        0,
+		Patience:           3,
+		Epoch:              5,
+		Stepsize:           20,
+		SizesOfLayers:      make([]int, 0),
+		NumLayer:           3,
+		TrainData:          make(DataFiles, 0),
+		TestData:           make(DataFiles, 0),
+		DataFormat:         XCRepoDataFormat,
+		ShardHeader:        GlobalShardHeader,
+		IndexBase:          1,
+		BinaryLabels:       false,
+		InferDimensions:    true,
+		PrefetchBatches:    2,
+		Shuffle:            NoShuffle,
+		ShuffleBufferSize:  10000,
+		Seed:               0,
+		LenientParsing:     false,
+		MaxErrorRate:       0.01,
+		QuarantineFile:     "",
+		Weights:            "",
+		SavedWeights:       "",
+		LogFile:            "",
+		Optimizer:          AdamOptimizer,
+		Momentum:           0.9,
+		Beta1:              0.9,
+		Beta2:              0.999,
+		Epsilon:            0.00000001,
+		Rho:                0.9,
+		WeightDecay:        0.01,
+		SparseUpdates:      true,
+		L2Regularization:   make([]float64, 0),
+		MaxNorm:            make([]float64, 0),
+		Dropout:            make([]float64, 0),
+		InputDropout:       0,
+		GradientClipping:   NoGradientClipping,
+		MaxGradientNorm:    5,
+		NanPolicy:          IgnoreNan,
+		NanDecayRate:       0.5,
+		CheckpointInterval: 100,
+		Quantization:       NoQuantization,
+		MetricsK:           []int{1, 3, 5},
+		PropensityA:        0.55,
+		PropensityB:        1.5,
+		ExactPrediction:    false,
+		PredictionsFile:    "",
+		PredictionsTopK:    100,
+		HashFunction:       DensifiedWtaHashFunction,
+		LoadWeight:         false,
+		LayerMode:          LayerMode4,
+		CpuProfile:         false,
+		MemProfile:         false,
 	}
 }
 
@@ -101,5 +311,23 @@ func FromJsonFile(jsonFilename string) (*Configuration, error) {
 		return nil, err
 	}
 
+	if config.CheckpointInterval <= 0 {
+		return nil, fmt.Errorf(
+			"CheckpointInterval must be positive, got %d",
+			config.CheckpointInterval)
+	}
+
+	// the sparsity of each layer for training, followed by the one for
+	// inference, which defaults to the training one
+	switch len(config.Sparsity) {
+	case config.NumLayer:
+		config.Sparsity = append(config.Sparsity, config.Sparsity...)
+	case 2 * config.NumLayer:
+	default:
+		return nil, fmt.Errorf(
+			"Sparsity must have %d or %d values, one or two per layer, got %d",
+			config.NumLayer, 2*config.NumLayer, len(config.Sparsity))
+	}
+
 	return config, nil
 }
@@ -0,0 +1,132 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"io"
+	"os"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/dataset/csr"
+	"github.com/nlpodyssey/goslide/dataset/libsvm"
+	"github.com/nlpodyssey/goslide/dataset/xcrepo"
+)
+
+var dataFormatNames = map[string]configuration.DataFormatType{
+	"xcrepo": configuration.XCRepoDataFormat,
+	"libsvm": configuration.LibSVMDataFormat,
+	"csr":    configuration.CSRDataFormat,
+}
+
+// convertDataset implements the convert command, converting a dataset
+// file from a format to another.
+func convertDataset(args []string) {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	from := flags.String("from", "xcrepo", "input format: xcrepo, libsvm or csr")
+	to := flags.String("to", "libsvm", "output format: xcrepo, libsvm or csr")
+	indexBase := flags.Int("index-base", 1, "first feature index of the LibSVM format")
+	numFeatures := flags.Int("features", 0, "number of features of LibSVM input, inferred if zero")
+	numLabels := flags.Int("labels", 0, "number of labels of LibSVM input, inferred if zero")
+	binaryLabels := flags.Bool("binary-labels", false, "read the -1 and +1 labels of LibSVM input as 0 and 1")
+	flags.Usage = func() {
+		logger.Println("Usage:\n  goslide convert [flags] <input_file> <output_file>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	inputFormat := parseDataFormat(*from)
+	outputFormat := parseDataFormat(*to)
+
+	inputFile, err := os.Open(flags.Arg(0))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer inputFile.Close()
+
+	reader := newReader(inputFormat, inputFile, *indexBase, *binaryLabels,
+		*numFeatures, *numLabels)
+	if err := reader.Err(); err != nil {
+		logger.Fatalf("Error at line %d. %v", reader.LineNumber(), err)
+	}
+	if closer, ok := reader.(io.Closer); ok {
+		defer closer.Close()
+	}
+	// the training validates the examples of a CSR file lazily, as
+	// they are read, while converting it all are validated beforehand
+	if rows, ok := reader.(*csr.Reader); ok {
+		if err := rows.Validate(); err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	outputFile, err := os.Create(flags.Arg(1))
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer outputFile.Close()
+
+	writer := newWriter(outputFormat, outputFile, reader, *indexBase)
+
+	numExamples := 0
+	for reader.Scan() {
+		if err := writer.Write(reader.Example()); err != nil {
+			logger.Fatalf("Error writing the example at line %d. %v",
+				reader.LineNumber(), err)
+		}
+		numExamples++
+	}
+	if err := reader.Err(); err != nil {
+		logger.Fatalf("Error at line %d. %v", reader.LineNumber(), err)
+	}
+
+	if err := writer.Close(); err != nil {
+		logger.Fatal(err)
+	}
+	if err := outputFile.Close(); err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Println("Converted", numExamples, "examples")
+}
+
+// newWriter creates a writer for the given format, with the dimensions
+// of the dataset read by the given reader.
+func newWriter(
+	format configuration.DataFormatType,
+	w io.Writer,
+	reader dataset.Reader,
+	indexBase int,
+) dataset.Writer {
+	switch format {
+	case configuration.XCRepoDataFormat:
+		writer, err := xcrepo.NewWriter(w,
+			reader.TotalPoints(), reader.NumFeatures(), reader.NumLabels())
+		if err != nil {
+			logger.Fatal(err)
+		}
+		return writer
+	case configuration.LibSVMDataFormat:
+		return libsvm.NewWriter(w, indexBase)
+	case configuration.CSRDataFormat:
+		return csr.NewWriter(w, reader.NumFeatures(), reader.NumLabels())
+	default:
+		logger.Fatalf("Unexpected data format %d.", format)
+		return nil
+	}
+}
+
+func parseDataFormat(name string) configuration.DataFormatType {
+	format, ok := dataFormatNames[name]
+	if !ok {
+		logger.Fatalf("Unknown data format %q.", name)
+	}
+	return format
+}
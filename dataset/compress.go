@@ -0,0 +1,47 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+)
+
+// Decompress detects gzip or bzip2 compressed data from the magic bytes
+// at the start of r, returning a reader of the decompressed data and
+// true. Otherwise, it returns r itself, positioned at the start, and
+// false.
+func Decompress(r io.ReadSeeker) (io.Reader, bool, error) {
+	magic := make([]byte, len(bzip2Magic))
+	n, err := io.ReadFull(r, magic)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, false, err
+	}
+	magic = magic[:n]
+
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		zr, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, false, err
+		}
+		return zr, true, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return bzip2.NewReader(r), true, nil
+	default:
+		return r, false, nil
+	}
+}
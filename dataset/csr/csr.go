@@ -0,0 +1,104 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Binary dataset format in Compressed Sparse Row (CSR) layout, designed
+// to be memory-mapped and read without parsing.
+//
+// All values are little-endian. The file starts with a header of
+// headerSize bytes:
+//
+//	magic            [8]byte "GSLDCSR" followed by the version
+//	totalPoints      uint64
+//	numFeatures      uint64
+//	numLabels        uint64
+//	numNonZeros      uint64  total number of features
+//	numLabelEntries  uint64  total number of labels
+//	reserved         [16]byte
+//
+// followed by the arrays:
+//
+//	featureOffsets  [totalPoints+1]uint64
+//	labelOffsets    [totalPoints+1]uint64
+//	indices         [numNonZeros]int32
+//	values          [numNonZeros]float32
+//	labels          [numLabelEntries]int32
+//
+// The features of the i-th point are indices and values in the range
+// featureOffsets[i] to featureOffsets[i+1], and likewise its labels.
+package csr
+
+import (
+	"errors"
+	"reflect"
+	"unsafe"
+)
+
+const (
+	headerSize = 64
+	version    = 1
+)
+
+var magic = [8]byte{'G', 'S', 'L', 'D', 'C', 'S', 'R', version}
+
+// Errors returned by Reader and Writer.
+var (
+	ErrMalformedHeader         = errors.New("csr: malformed or missing header")
+	ErrUnsupportedVersion      = errors.New("csr: unsupported version")
+	ErrTruncated               = errors.New("csr: truncated data")
+	ErrMalformedOffsets        = errors.New("csr: malformed offsets")
+	ErrLabelOutOfBounds        = errors.New("csr: label value out of bounds")
+	ErrFeatureIndexOutOfBounds = errors.New("csr: feature index out of bounds")
+	ErrBigEndian               = errors.New("csr: big-endian hosts are not supported")
+)
+
+// header holds the decoded header values.
+type header struct {
+	totalPoints     int
+	numFeatures     int
+	numLabels       int
+	numNonZeros     int
+	numLabelEntries int
+}
+
+// size returns the expected size of the whole data.
+func (h header) size() int {
+	return headerSize + 2*8*(h.totalPoints+1) +
+		4*(2*h.numNonZeros+h.numLabelEntries)
+}
+
+func isLittleEndian() bool {
+	x := uint16(1)
+	return *(*byte)(unsafe.Pointer(&x)) == 1
+}
+
+// The following functions return slices sharing the memory of b,
+// which must be suitably aligned.
+
+func uint64Slice(b []byte) []uint64 {
+	var s []uint64
+	setSliceHeader(unsafe.Pointer(&s), b, len(b)/8)
+	return s
+}
+
+func int32Slice(b []byte) []int32 {
+	var s []int32
+	setSliceHeader(unsafe.Pointer(&s), b, len(b)/4)
+	return s
+}
+
+func float32Slice(b []byte) []float32 {
+	var s []float32
+	setSliceHeader(unsafe.Pointer(&s), b, len(b)/4)
+	return s
+}
+
+func setSliceHeader(slice unsafe.Pointer, b []byte, length int) {
+	if length == 0 {
+		return
+	}
+	h := (*reflect.SliceHeader)(slice)
+	h.Data = uintptr(unsafe.Pointer(&b[0]))
+	h.Len = length
+	h.Cap = length
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csr
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+var testExamples = []dataset.Example{
+	{
+		Features: []index_value.Pair{{Index: 1, Value: 0.5}, {Index: 4, Value: 1}},
+		Labels:   []int{0, 2},
+	},
+	{
+		Features: []index_value.Pair{{Index: 3, Value: 2}},
+		Labels:   []int{},
+	},
+	{
+		Features: []index_value.Pair{},
+		Labels:   []int{1},
+	},
+}
+
+func TestWriterReader(t *testing.T) {
+	file := writeTempFile(t, 0, 3)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	r := NewReader(file)
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	assertIntEqual(t, r.TotalPoints(), 3, "TotalPoints")
+	assertIntEqual(t, r.NumFeatures(), 5, "NumFeatures")
+	assertIntEqual(t, r.NumLabels(), 3, "NumLabels")
+
+	indices, values, labels := r.Row(0)
+	assertIntEqual(t, len(indices), 2, "len(indices)")
+	assertIntEqual(t, int(indices[1]), 4, "index")
+	if values[0] != 0.5 {
+		t.Errorf("Assertion failed: value | expected 0.5, actual %g", values[0])
+	}
+	assertIntEqual(t, int(labels[1]), 2, "label")
+
+	for pass := 0; pass < 2; pass++ {
+		for i, expected := range testExamples {
+			if !r.Scan() {
+				t.Fatalf("Scan failed: %v", r.Err())
+			}
+			assertIntEqual(t, r.LineNumber(), i+1, "LineNumber")
+			assertExampleEqual(t, r.Example(), expected)
+		}
+		if r.Scan() {
+			t.Error("Expected end of data")
+		}
+		if err := r.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertExampleEqual(t, r.At(1), testExamples[1])
+}
+
+func TestReaderScanChunks(t *testing.T) {
+	examples := make([]dataset.Example, 2*scanChunkSize+3)
+	for i := range examples {
+		examples[i] = dataset.Example{
+			Features: make([]index_value.Pair, i%3),
+			Labels:   make([]int, i%2),
+		}
+		for j := range examples[i].Features {
+			examples[i].Features[j] = index_value.Pair{
+				Index: j, Value: mat.Float(i),
+			}
+		}
+		for j := range examples[i].Labels {
+			examples[i].Labels[j] = i % 5
+		}
+	}
+
+	file := writeExamples(t, examples, 0, 0)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	r := NewReader(file)
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	var scanned []dataset.Example
+	for r.Scan() {
+		scanned = append(scanned, r.Example())
+	}
+	r.Close()
+
+	// the examples are copies, which remain valid after closing
+	assertIntEqual(t, len(scanned), len(examples), "scanned examples")
+	for i, expected := range examples {
+		assertExampleEqual(t, scanned[i], expected)
+	}
+
+	// and they do not overlap within the chunks
+	_ = append(scanned[2].Features, index_value.Pair{Index: 9, Value: 9})
+	_ = append(scanned[1].Labels, 9)
+	assertExampleEqual(t, scanned[4], examples[4])
+	assertExampleEqual(t, scanned[3], examples[3])
+}
+
+func TestReaderErrors(t *testing.T) {
+	file := writeTempFile(t, 5, 3)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		err    error
+	}{
+		{"empty", func(b []byte) []byte { return b[:0] }, ErrMalformedHeader},
+		{"magic", func(b []byte) []byte { b[0] = 'X'; return b }, ErrMalformedHeader},
+		{"version", func(b []byte) []byte { b[7] = 9; return b }, ErrUnsupportedVersion},
+		{"truncated", func(b []byte) []byte { return b[:len(b)-4] }, ErrTruncated},
+		{"offsets", func(b []byte) []byte { b[headerSize+8] = 9; return b }, ErrMalformedOffsets},
+	}
+
+	for _, test := range tests {
+		mutated := test.mutate(append([]byte(nil), data...))
+		if err := ioutil.WriteFile(file.Name(), mutated, 0600); err != nil {
+			t.Fatal(err)
+		}
+		r := NewReader(file)
+		if r.Err() != test.err {
+			t.Errorf("Assertion failed: %s | expected %v, actual %v",
+				test.name, test.err, r.Err())
+		}
+		r.Close()
+	}
+}
+
+func TestReaderInvalidExamples(t *testing.T) {
+	file := writeTempFile(t, 5, 3)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		mutate func([]byte) []byte
+		err    error
+		line   int // of the first invalid example read by ReadBatch
+	}{
+		{"features", func(b []byte) []byte { b[16] = 2; return b }, ErrFeatureIndexOutOfBounds, 1},
+		{"labels", func(b []byte) []byte { b[24] = 1; return b }, ErrLabelOutOfBounds, 3},
+	}
+
+	for _, test := range tests {
+		mutated := test.mutate(append([]byte(nil), data...))
+		if err := ioutil.WriteFile(file.Name(), mutated, 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		// the examples are not validated opening the file
+		r := NewReader(file)
+		if err := r.Err(); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if err := r.Validate(); err != test.err {
+			t.Errorf("Assertion failed: %s Validate | expected %v, actual %v",
+				test.name, test.err, err)
+		}
+
+		var batch Batch
+		_, err := r.ReadBatch(&batch, []int{2, 0})
+		var readErr *dataset.ReadError
+		if !errors.As(err, &readErr) || readErr.Err != test.err {
+			t.Errorf("Assertion failed: %s ReadBatch | expected %v, actual %v",
+				test.name, test.err, err)
+		} else {
+			assertIntEqual(t, readErr.LineNumber, test.line, test.name+" ReadBatch line")
+		}
+
+		if r.Scan() {
+			t.Errorf("%s: expected Scan to fail", test.name)
+		}
+		if r.Err() != test.err {
+			t.Errorf("Assertion failed: %s Scan | expected %v, actual %v",
+				test.name, test.err, r.Err())
+		}
+		assertIntEqual(t, r.LineNumber(), 1, test.name+" LineNumber")
+		r.Close()
+
+		r = NewReader(file)
+		p := dataset.NewPermutedReader(r, 1)
+		for p.Scan() {
+		}
+		if p.Err() != test.err {
+			t.Errorf("Assertion failed: %s PermutedReader | expected %v, actual %v",
+				test.name, test.err, p.Err())
+		}
+		r.Close()
+	}
+}
+
+func TestReaderReadBatch(t *testing.T) {
+	file := writeTempFile(t, 0, 3)
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	r := NewReader(file)
+	if err := r.Err(); err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	var batch Batch
+	examples, err := r.ReadBatch(&batch, []int{2, 0, 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, len(examples), 3, "len(examples)")
+	for i, row := range []int{2, 0, 1} {
+		assertExampleEqual(t, examples[i], testExamples[row])
+	}
+	features := &examples[1].Features[0]
+
+	// the memory of the previous batch is reused
+	examples, err = r.ReadBatch(&batch, []int{0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, len(examples), 1, "len(examples)")
+	assertExampleEqual(t, examples[0], testExamples[0])
+	if &examples[0].Features[0] != features {
+		t.Error("Expected the memory of the previous batch to be reused")
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	w := NewWriter(ioutil.Discard, 4, 3)
+	if err := w.Write(testExamples[0]); err != ErrFeatureIndexOutOfBounds {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrFeatureIndexOutOfBounds, err)
+	}
+	w = NewWriter(ioutil.Discard, 5, 2)
+	if err := w.Write(testExamples[0]); err != ErrLabelOutOfBounds {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrLabelOutOfBounds, err)
+	}
+}
+
+func writeTempFile(t *testing.T, numFeatures, numLabels int) *os.File {
+	return writeExamples(t, testExamples, numFeatures, numLabels)
+}
+
+func writeExamples(
+	t *testing.T,
+	examples []dataset.Example,
+	numFeatures, numLabels int,
+) *os.File {
+	file, err := ioutil.TempFile("", "csr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := NewWriter(file, numFeatures, numLabels)
+	for _, example := range examples {
+		if err := w.Write(example); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func assertExampleEqual(t *testing.T, actual, expected dataset.Example) {
+	assertIntEqual(t, len(actual.Features), len(expected.Features), "len(Features)")
+	for i, pair := range expected.Features {
+		if actual.Features[i] != pair {
+			t.Errorf("Assertion failed: feature %d | expected %v, actual %v",
+				i, pair, actual.Features[i])
+		}
+	}
+	assertIntEqual(t, len(actual.Labels), len(expected.Labels), "len(Labels)")
+	for i, label := range expected.Labels {
+		assertIntEqual(t, actual.Labels[i], label, "label")
+	}
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
@@ -0,0 +1,24 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package csr
+
+import (
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+)
+
+// mapFile reads the whole file in memory, where mmap is not available.
+func mapFile(file *os.File) ([]byte, error) {
+	return ioutil.ReadAll(io.NewSectionReader(file, 0, math.MaxInt64))
+}
+
+func unmapFile([]byte) error {
+	return nil
+}
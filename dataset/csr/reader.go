@@ -0,0 +1,344 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csr
+
+import (
+	"encoding/binary"
+	"math"
+	"os"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// Reader provides sequential and random access to the examples of a
+// memory-mapped file.
+//
+// The examples returned by Example and At are copies, converted to the
+// int indices and mat.Float values of dataset.Example. ReadBatch
+// converts them into reused memory, and Row gives access to an example
+// without copying it, with the types of the file.
+//
+// Only the header and the offsets are validated opening the file, so
+// that the rest of the data is loaded lazily: the indices and the
+// labels of each example are checked converting it, or all at once by
+// Validate.
+type Reader struct {
+	data           []byte
+	err            error
+	header         header
+	featureOffsets []uint64
+	labelOffsets   []uint64
+	indices        []int32
+	values         []float32
+	labels         []int32
+	position       int // index of the next example to scan
+	example        dataset.Example
+	chunk          []dataset.Example // converted, but not yet scanned
+	rows           []int             // indices of the chunk to convert
+}
+
+// Batch holds the memory of the examples read by ReadBatch, which is
+// reused by the following reads into the same Batch.
+type Batch struct {
+	examples []dataset.Example
+	features []index_value.Pair
+	labels   []int
+}
+
+// scanChunkSize is the number of examples converted at once by Scan.
+const scanChunkSize = 256
+
+var _ dataset.Reader = &Reader{}
+var _ dataset.RandomAccess = &Reader{}
+
+// NewReader memory-maps the given file, validating its header and its
+// offsets. The Reader must be closed once done, before closing the file.
+func NewReader(file *os.File) *Reader {
+	r := &Reader{}
+	if !isLittleEndian() {
+		r.err = ErrBigEndian
+		return r
+	}
+
+	r.data, r.err = mapFile(file)
+	if r.err != nil {
+		return r
+	}
+
+	if r.err = r.readHeader(); r.err != nil {
+		return r
+	}
+	r.err = r.validateOffsets()
+	return r
+}
+
+// Validate checks the feature indices and the labels of all the
+// examples, reading the whole file.
+func (r *Reader) Validate() error {
+	if r.err != nil {
+		return r.err
+	}
+	h := r.header
+	for _, index := range r.indices {
+		if index < 0 || int(index) >= h.numFeatures {
+			return ErrFeatureIndexOutOfBounds
+		}
+	}
+	for _, label := range r.labels {
+		if label < 0 || int(label) >= h.numLabels {
+			return ErrLabelOutOfBounds
+		}
+	}
+	return nil
+}
+
+// Close releases the memory-mapped data. The slices returned by Row
+// must not be used afterwards.
+func (r *Reader) Close() error {
+	if r.data == nil {
+		return nil
+	}
+	err := unmapFile(r.data)
+	*r = Reader{err: os.ErrClosed}
+	return err
+}
+
+// Err returns the error encountered opening the file, or converting an
+// example with out of bounds indices or labels.
+func (r *Reader) Err() error {
+	return r.err
+}
+
+// LineNumber returns the 1-based number of the last scanned example,
+// or of the invalid one.
+func (r *Reader) LineNumber() int {
+	return r.position
+}
+
+// Reset restarts scanning from the first example.
+func (r *Reader) Reset() error {
+	r.position = 0
+	r.chunk = nil
+	return r.err
+}
+
+func (r *Reader) TotalPoints() int {
+	return r.header.totalPoints
+}
+
+func (r *Reader) NumFeatures() int {
+	return r.header.numFeatures
+}
+
+func (r *Reader) NumLabels() int {
+	return r.header.numLabels
+}
+
+func (r *Reader) Example() dataset.Example {
+	return r.example
+}
+
+// Scan advances to the next example. The examples are converted in
+// chunks of consecutive ones, sharing the memory of their features and
+// labels, so that there are only a few allocations per chunk. Keeping
+// an example keeps its whole chunk in memory.
+func (r *Reader) Scan() bool {
+	r.example = dataset.Example{}
+	if r.err != nil || r.position >= r.header.totalPoints {
+		return false
+	}
+	if len(r.chunk) == 0 {
+		end := r.position + scanChunkSize
+		if end > r.header.totalPoints {
+			end = r.header.totalPoints
+		}
+		r.rows = r.rows[:0]
+		for i := r.position; i < end; i++ {
+			r.rows = append(r.rows, i)
+		}
+		var batch Batch
+		if invalid, err := r.convertRows(&batch, r.rows); err != nil {
+			r.err = err
+			r.position = invalid + 1
+			return false
+		}
+		r.chunk = batch.examples
+	}
+	r.example = r.chunk[0]
+	r.chunk = r.chunk[1:]
+	r.position++
+	return true
+}
+
+// At returns a copy of the i-th example, converted to the types of
+// dataset.Example. The features and the labels are newly allocated,
+// so that the example can be kept after closing the Reader; use Row to
+// avoid the copy. If the example is invalid, At returns an empty one,
+// and Err the error.
+func (r *Reader) At(i int) dataset.Example {
+	var batch Batch
+	if _, err := r.convertRows(&batch, []int{i}); err != nil {
+		r.err = err
+		return dataset.Example{}
+	}
+	return batch.examples[0]
+}
+
+// ReadBatch converts the examples with the given indices into batch,
+// reusing its memory, and returns them. They are valid until the next
+// read into the same batch. An invalid example is reported as a
+// *dataset.ReadError, with its 1-based number as line.
+func (r *Reader) ReadBatch(batch *Batch, rows []int) ([]dataset.Example, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+	if invalid, err := r.convertRows(batch, rows); err != nil {
+		return nil, &dataset.ReadError{LineNumber: invalid + 1, Err: err}
+	}
+	return batch.examples, nil
+}
+
+// Row returns the feature indices, the feature values and the labels
+// of the i-th example, sharing the memory-mapped data. They must not
+// be modified.
+func (r *Reader) Row(i int) (indices []int32, values []float32, labels []int32) {
+	start, end := r.featureOffsets[i], r.featureOffsets[i+1]
+	labelStart, labelEnd := r.labelOffsets[i], r.labelOffsets[i+1]
+	return r.indices[start:end:end], r.values[start:end:end],
+		r.labels[labelStart:labelEnd:labelEnd]
+}
+
+// convertRows converts the examples with the given indices into
+// batch, growing its memory as needed, so that the features and the
+// labels of all the examples share two slices. It returns the index
+// of the first invalid example, with its error.
+func (r *Reader) convertRows(batch *Batch, rows []int) (int, error) {
+	numFeatures, numLabels := 0, 0
+	for _, i := range rows {
+		numFeatures += int(r.featureOffsets[i+1] - r.featureOffsets[i])
+		numLabels += int(r.labelOffsets[i+1] - r.labelOffsets[i])
+	}
+	if cap(batch.examples) < len(rows) {
+		batch.examples = make([]dataset.Example, len(rows))
+	}
+	if cap(batch.features) < numFeatures {
+		batch.features = make([]index_value.Pair, numFeatures)
+	}
+	if cap(batch.labels) < numLabels {
+		batch.labels = make([]int, numLabels)
+	}
+	batch.examples = batch.examples[:len(rows)]
+	features := batch.features[:numFeatures]
+	labels := batch.labels[:numLabels]
+
+	h := r.header
+	for n, i := range rows {
+		rowIndices, rowValues, rowLabels := r.Row(i)
+
+		example := dataset.Example{
+			Features: features[:len(rowIndices):len(rowIndices)],
+			Labels:   labels[:len(rowLabels):len(rowLabels)],
+		}
+		features = features[len(rowIndices):]
+		labels = labels[len(rowLabels):]
+
+		for j, index := range rowIndices {
+			if index < 0 || int(index) >= h.numFeatures {
+				return i, ErrFeatureIndexOutOfBounds
+			}
+			example.Features[j] = index_value.Pair{
+				Index: int(index),
+				Value: mat.Float(rowValues[j]),
+			}
+		}
+		for j, label := range rowLabels {
+			if label < 0 || int(label) >= h.numLabels {
+				return i, ErrLabelOutOfBounds
+			}
+			example.Labels[j] = int(label)
+		}
+		batch.examples[n] = example
+	}
+	return 0, nil
+}
+
+func (r *Reader) readHeader() error {
+	if len(r.data) < headerSize {
+		return ErrMalformedHeader
+	}
+	if string(r.data[:len(magic)-1]) != string(magic[:len(magic)-1]) {
+		return ErrMalformedHeader
+	}
+	if r.data[len(magic)-1] != version {
+		return ErrUnsupportedVersion
+	}
+
+	var values [5]uint64
+	for i := range values {
+		values[i] = binary.LittleEndian.Uint64(r.data[len(magic)+8*i:])
+	}
+	totalPoints, numFeatures, numLabels := values[0], values[1], values[2]
+	numNonZeros, numLabelEntries := values[3], values[4]
+
+	// indices and labels are int32
+	if numFeatures > math.MaxInt32+1 || numLabels > math.MaxInt32+1 {
+		return ErrMalformedHeader
+	}
+	// prevents overflows computing the expected size
+	size := uint64(len(r.data))
+	if totalPoints > size || numNonZeros > size || numLabelEntries > size {
+		return ErrTruncated
+	}
+
+	h := header{
+		totalPoints:     int(totalPoints),
+		numFeatures:     int(numFeatures),
+		numLabels:       int(numLabels),
+		numNonZeros:     int(numNonZeros),
+		numLabelEntries: int(numLabelEntries),
+	}
+	if h.size() != len(r.data) {
+		return ErrTruncated
+	}
+	r.header = h
+
+	data := r.data[headerSize:]
+	next := func(n int) []byte {
+		b := data[:n]
+		data = data[n:]
+		return b
+	}
+	r.featureOffsets = uint64Slice(next(8 * (h.totalPoints + 1)))
+	r.labelOffsets = uint64Slice(next(8 * (h.totalPoints + 1)))
+	r.indices = int32Slice(next(4 * h.numNonZeros))
+	r.values = float32Slice(next(4 * h.numNonZeros))
+	r.labels = int32Slice(next(4 * h.numLabelEntries))
+	return nil
+}
+
+func (r *Reader) validateOffsets() error {
+	h := r.header
+	if !validOffsets(r.featureOffsets, h.numNonZeros) ||
+		!validOffsets(r.labelOffsets, h.numLabelEntries) {
+		return ErrMalformedOffsets
+	}
+	return nil
+}
+
+// validOffsets reports whether the offsets start from zero, are not
+// decreasing and end at length.
+func validOffsets(offsets []uint64, length int) bool {
+	if offsets[0] != 0 || offsets[len(offsets)-1] != uint64(length) {
+		return false
+	}
+	for i := 1; i < len(offsets); i++ {
+		if offsets[i] < offsets[i-1] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package csr
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/nlpodyssey/goslide/dataset"
+)
+
+// Writer writes a dataset. Since the arrays are stored one after the
+// other, all the examples are kept in memory until Close.
+type Writer struct {
+	w              io.Writer
+	header         header
+	featureOffsets []uint64
+	labelOffsets   []uint64
+	indices        []int32
+	values         []float32
+	labels         []int32
+}
+
+var _ dataset.Writer = &Writer{}
+
+// NewWriter creates a Writer for the given dimensions. Unknown values
+// can be given as zero, to be set by Close as the highest feature index
+// and label written, plus one.
+func NewWriter(w io.Writer, numFeatures, numLabels int) *Writer {
+	return &Writer{
+		w: w,
+		header: header{
+			numFeatures: numFeatures,
+			numLabels:   numLabels,
+		},
+		featureOffsets: []uint64{0},
+		labelOffsets:   []uint64{0},
+	}
+}
+
+// Write adds the next example. Feature values are stored as float32.
+func (cw *Writer) Write(example dataset.Example) error {
+	h := &cw.header
+
+	for _, pair := range example.Features {
+		if !inBounds(pair.Index, h.numFeatures) {
+			return ErrFeatureIndexOutOfBounds
+		}
+	}
+	for _, label := range example.Labels {
+		if !inBounds(label, h.numLabels) {
+			return ErrLabelOutOfBounds
+		}
+	}
+
+	for _, pair := range example.Features {
+		cw.indices = append(cw.indices, int32(pair.Index))
+		cw.values = append(cw.values, float32(pair.Value))
+	}
+	for _, label := range example.Labels {
+		cw.labels = append(cw.labels, int32(label))
+	}
+
+	cw.featureOffsets = append(cw.featureOffsets, uint64(len(cw.indices)))
+	cw.labelOffsets = append(cw.labelOffsets, uint64(len(cw.labels)))
+	h.totalPoints++
+	return nil
+}
+
+// Close writes all the data to the underlying io.Writer, without
+// closing it.
+func (cw *Writer) Close() error {
+	h := cw.header
+	h.numNonZeros = len(cw.indices)
+	h.numLabelEntries = len(cw.labels)
+	if h.numFeatures <= 0 {
+		h.numFeatures = maxInt32(cw.indices) + 1
+	}
+	if h.numLabels <= 0 {
+		h.numLabels = maxInt32(cw.labels) + 1
+	}
+
+	var buf [headerSize]byte
+	copy(buf[:], magic[:])
+	for i, v := range []int{h.totalPoints, h.numFeatures, h.numLabels,
+		h.numNonZeros, h.numLabelEntries} {
+		binary.LittleEndian.PutUint64(buf[len(magic)+8*i:], uint64(v))
+	}
+
+	bw := bufio.NewWriter(cw.w)
+	if _, err := bw.Write(buf[:]); err != nil {
+		return err
+	}
+	for _, array := range []interface{}{cw.featureOffsets, cw.labelOffsets,
+		cw.indices, cw.values, cw.labels} {
+		if err := binary.Write(bw, binary.LittleEndian, array); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// inBounds reports whether i is a valid index for an array of length
+// n, where zero is unknown, within the int32 range.
+func inBounds(i, n int) bool {
+	return i >= 0 && i <= math.MaxInt32 && (n <= 0 || i < n)
+}
+
+func maxInt32(values []int32) int {
+	max := -1
+	for _, v := range values {
+		if int(v) > max {
+			max = int(v)
+		}
+	}
+	return max
+}
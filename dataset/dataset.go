@@ -4,9 +4,57 @@
 
 package dataset
 
-import "github.com/nlpodyssey/goslide/index_value"
+import (
+	"errors"
+
+	"github.com/nlpodyssey/goslide/index_value"
+)
 
 type Example struct {
 	Features []index_value.Pair
 	Labels   []int
 }
+
+// Reader reads the examples of a dataset sequentially, independently
+// of its format.
+type Reader interface {
+	// Scan advances the Reader to the next example, which will then be
+	// available through Example. It returns false when the scan stops,
+	// either by reaching the end of the input or an error.
+	Scan() bool
+	// Example returns the last example read by Scan.
+	Example() Example
+	// Err returns the first non-EOF error that was encountered.
+	Err() error
+	// LineNumber returns the line, or the record, of the input where
+	// the last example was read, or where an error occurred.
+	LineNumber() int
+	// Reset restarts reading from the first example.
+	Reset() error
+
+	// TotalPoints returns the number of examples declared by the dataset.
+	TotalPoints() int
+	// NumFeatures returns the dimension of the features space.
+	NumFeatures() int
+	// NumLabels returns the number of distinct labels.
+	NumLabels() int
+}
+
+// Errors of the malformed examples, shared by the text formats. The
+// readers return errors wrapping them, prefixed with the reader name,
+// which can be checked with errors.Is.
+var (
+	ErrMalformedLabels         = errors.New("malformed labels")
+	ErrMalformedFeatures       = errors.New("malformed features")
+	ErrLabelOutOfBounds        = errors.New("label value out of bounds")
+	ErrFeatureIndexOutOfBounds = errors.New("feature index out of bounds")
+)
+
+// Writer writes the examples of a dataset sequentially.
+type Writer interface {
+	// Write writes the next example.
+	Write(example Example) error
+	// Close completes the output, without closing the underlying
+	// io.Writer.
+	Close() error
+}
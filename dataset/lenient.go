@@ -0,0 +1,109 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrTooManyErrors is returned by Lenient.Skip when the error rate
+// exceeds the maximum.
+var ErrTooManyErrors = errors.New("dataset: too many malformed lines")
+
+// LenientReader is a Reader which can skip the malformed lines,
+// according to the given policy, instead of stopping. The name
+// identifies the data in the policy quarantine.
+type LenientReader interface {
+	Reader
+	SetLenient(lenient *Lenient, name string)
+}
+
+// Lenient is the policy of a reader which skips malformed lines,
+// instead of stopping at the first one.
+//
+// The skipped lines are counted by error, and written to the quarantine
+// io.Writer, if not nil, one per line as:
+//
+//	name:lineNumber<TAB>error<TAB>line
+//
+// where name identifies the data, such as a shard of the dataset.
+//
+// Since a dataset is usually read several times, the counts refer to the
+// current pass only, and each line is written to the quarantine once.
+type Lenient struct {
+	maxErrorRate float64
+	totalLines   int
+	quarantine   io.Writer
+	counts       map[error]int
+	numSkipped   int
+	numLines     int            // lines read during the current pass
+	quarantined  map[string]int // highest quarantined line number
+}
+
+// NewLenient creates a Lenient policy, which allows skipping up to
+// maxErrorRate of the totalLines of each pass. If totalLines is not
+// positive, because it is unknown, the error rate is computed over the
+// lines read so far during the pass (see CountLine).
+func NewLenient(maxErrorRate float64, totalLines int, quarantine io.Writer) *Lenient {
+	return &Lenient{
+		maxErrorRate: maxErrorRate,
+		totalLines:   totalLines,
+		quarantine:   quarantine,
+		counts:       make(map[error]int),
+		quarantined:  make(map[string]int),
+	}
+}
+
+// Skip records a line of the named data, skipped because of err. It
+// returns ErrTooManyErrors if the maximum error rate is exceeded, or the
+// error writing to the quarantine.
+func (l *Lenient) Skip(name string, lineNumber int, line []byte, err error) error {
+	l.counts[err]++
+	l.numSkipped++
+
+	if l.quarantine != nil && lineNumber > l.quarantined[name] {
+		l.quarantined[name] = lineNumber
+		_, writeErr := fmt.Fprintf(l.quarantine, "%s:%d\t%v\t%s\n",
+			name, lineNumber, err, line)
+		if writeErr != nil {
+			return writeErr
+		}
+	}
+
+	totalLines := l.totalLines
+	if totalLines <= 0 {
+		totalLines = l.numLines
+	}
+	if float64(l.numSkipped) > l.maxErrorRate*float64(totalLines) {
+		return ErrTooManyErrors
+	}
+	return nil
+}
+
+// CountLine records that a line was read, either valid or skipped.
+// Readers must call it for each line before Skip.
+func (l *Lenient) CountLine() {
+	l.numLines++
+}
+
+// Counts returns the number of lines skipped during the current pass
+// for each error.
+func (l *Lenient) Counts() map[error]int {
+	return l.counts
+}
+
+// NumSkipped returns the number of lines skipped during the current pass.
+func (l *Lenient) NumSkipped() int {
+	return l.numSkipped
+}
+
+// Reset starts counting the errors of a new pass.
+func (l *Lenient) Reset() {
+	l.counts = make(map[error]int)
+	l.numSkipped = 0
+	l.numLines = 0
+}
@@ -0,0 +1,379 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Input support for the LibSVM / SVMlight sparse format, extended to
+// multiple comma-separated labels:
+//
+//	label[,label...] [qid:n] index:value ... [# comment]
+//
+// Labels are non-negative integers, with an optional plus sign. The
+// -1 and +1 labels of binary datasets are read as 0 and 1 by the
+// Scanner created with NewBinaryScanner. Lines can be of any length.
+//
+// There is no header line: the dimensions are given, or inferred with
+// a first pass over the data. Empty and comment-only lines are skipped.
+package libsvm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+type Scanner struct {
+	r           io.Reader
+	bufScanner  *bufio.Scanner
+	err         error
+	lineNumber  int
+	indexBase   int
+	totalPoints int
+	numFeatures int
+	numLabels   int
+	maxFeature  int // highest feature index read so far
+	maxLabel    int // highest label read so far
+	example     dataset.Example
+	qid         int
+	binary      bool             // -1 and +1 labels read as 0 and 1
+	lenient     *dataset.Lenient // nil to stop at the first malformed line
+	name        string           // of the data, for the lenient policy
+}
+
+// Errors returned by Scanner.
+var (
+	ErrMalformedLabels         = fmt.Errorf("libsvm.Scanner: %w", dataset.ErrMalformedLabels)
+	ErrMalformedQid            = errors.New("libsvm.Scanner: malformed qid")
+	ErrMalformedFeatures       = fmt.Errorf("libsvm.Scanner: %w", dataset.ErrMalformedFeatures)
+	ErrLabelOutOfBounds        = fmt.Errorf("libsvm.Scanner: %w", dataset.ErrLabelOutOfBounds)
+	ErrFeatureIndexOutOfBounds = fmt.Errorf("libsvm.Scanner: %w", dataset.ErrFeatureIndexOutOfBounds)
+	ErrNotSeekable             = errors.New("libsvm.Scanner: reset or dimensions inference requires an io.Seeker")
+)
+
+var _ dataset.LenientReader = &Scanner{}
+
+// NewScanner creates a Scanner for data whose feature indices start
+// from indexBase, usually 1. Labels are always 0-based.
+//
+// If numFeatures or numLabels are not positive, they are inferred with
+// a first pass over the data, as the highest index found plus one. The
+// first pass also counts the total points, which is otherwise unknown
+// and reported as zero. It requires r to implement io.Seeker. Malformed
+// lines are ignored by the first pass, and reported or skipped when
+// reading the data.
+func NewScanner(r io.Reader, indexBase, numFeatures, numLabels int) *Scanner {
+	s := &Scanner{
+		r:           r,
+		bufScanner:  newLineScanner(r),
+		indexBase:   indexBase,
+		numFeatures: numFeatures,
+		numLabels:   numLabels,
+		maxFeature:  -1,
+		maxLabel:    -1,
+	}
+
+	if numFeatures <= 0 || numLabels <= 0 {
+		s.inferDimensions()
+	}
+
+	return s
+}
+
+// NewBinaryScanner creates a Scanner for the data of a binary
+// classification problem, labelled as -1 and +1, which are read as the
+// labels 0 and 1. Any other label is out of bounds. The number of
+// features is inferred if not positive, as for NewScanner.
+func NewBinaryScanner(r io.Reader, indexBase, numFeatures int) *Scanner {
+	s := &Scanner{
+		r:           r,
+		bufScanner:  newLineScanner(r),
+		indexBase:   indexBase,
+		numFeatures: numFeatures,
+		numLabels:   2,
+		maxFeature:  -1,
+		maxLabel:    -1,
+		binary:      true,
+	}
+
+	if numFeatures <= 0 {
+		s.inferDimensions()
+	}
+
+	return s
+}
+
+// SetLenient makes the Scanner skip the malformed lines, according to
+// the given policy, instead of stopping. The name identifies the data
+// in the policy quarantine. Errors reading the input are not skipped.
+func (s *Scanner) SetLenient(lenient *dataset.Lenient, name string) {
+	s.lenient = lenient
+	s.name = name
+}
+
+// Err returns the first non-EOF error that was encountered by the Scanner.
+func (s *Scanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.bufScanner.Err()
+}
+
+// Reset seeks the underlying reader to the beginning. The reader must
+// implement io.Seeker.
+func (s *Scanner) Reset() error {
+	seeker, ok := s.r.(io.Seeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.bufScanner = newLineScanner(s.r)
+	if s.lenient != nil {
+		s.lenient.Reset()
+	}
+	s.err = nil
+	s.lineNumber = 0
+	s.example = dataset.Example{}
+	s.qid = 0
+	return nil
+}
+
+func (s *Scanner) LineNumber() int {
+	return s.lineNumber
+}
+
+func (s *Scanner) TotalPoints() int {
+	return s.totalPoints
+}
+
+func (s *Scanner) NumFeatures() int {
+	return s.numFeatures
+}
+
+func (s *Scanner) NumLabels() int {
+	return s.numLabels
+}
+
+func (s *Scanner) Example() dataset.Example {
+	return s.example
+}
+
+// Qid returns the query ID of the last example, or zero if missing.
+func (s *Scanner) Qid() int {
+	return s.qid
+}
+
+func (s *Scanner) Scan() bool {
+	s.example.Features = nil
+	s.example.Labels = nil
+	s.qid = 0
+
+	if s.Err() != nil {
+		return false
+	}
+
+	for {
+		if ok := s.bufScanner.Scan(); !ok {
+			return false
+		}
+		s.lineNumber++
+
+		line := s.bufScanner.Text()
+		text := line
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+
+		if s.lenient != nil {
+			s.lenient.CountLine()
+		}
+		if s.parseFields(fields) {
+			s.updateMaxIndices()
+			return true
+		}
+		if s.lenient == nil {
+			return false
+		}
+
+		err := s.lenient.Skip(s.name, s.lineNumber, []byte(line), s.err)
+		s.example = dataset.Example{}
+		s.qid = 0
+		s.err = err
+		if err != nil {
+			return false
+		}
+	}
+}
+
+// parseFields parses an example, setting the error if malformed.
+func (s *Scanner) parseFields(fields []string) bool {
+	// a line can start with the features, when it has no labels
+	if !strings.ContainsRune(fields[0], ':') {
+		if ok := s.parseLabels(fields[0]); !ok {
+			return false
+		}
+		fields = fields[1:]
+	} else {
+		s.example.Labels = make([]int, 0)
+	}
+
+	if len(fields) > 0 && strings.HasPrefix(fields[0], "qid:") {
+		if ok := s.parseQid(fields[0]); !ok {
+			return false
+		}
+		fields = fields[1:]
+	}
+
+	return s.parseFeatures(fields)
+}
+
+func (s *Scanner) parseLabels(str string) bool {
+	labels := strings.Split(str, ",")
+	s.example.Labels = make([]int, len(labels))
+
+	for i, value := range labels {
+		label, err := strconv.Atoi(value)
+		if err != nil {
+			s.err = ErrMalformedLabels
+			return false
+		}
+		if s.binary {
+			label = binaryLabel(label)
+		}
+		if label < 0 || (s.numLabels > 0 && label >= s.numLabels) {
+			s.err = ErrLabelOutOfBounds
+			return false
+		}
+		s.example.Labels[i] = label
+	}
+	return true
+}
+
+func (s *Scanner) parseQid(str string) bool {
+	qid, err := strconv.Atoi(str[len("qid:"):])
+	if err != nil {
+		s.err = ErrMalformedQid
+		return false
+	}
+	s.qid = qid
+	return true
+}
+
+func (s *Scanner) parseFeatures(pairs []string) bool {
+	s.example.Features = make([]index_value.Pair, len(pairs))
+
+	for i, pair := range pairs {
+		splitPair := strings.Split(pair, ":")
+		if len(splitPair) != 2 {
+			s.err = ErrMalformedFeatures
+			return false
+		}
+
+		featureIndex, err := strconv.Atoi(splitPair[0])
+		if err != nil {
+			s.err = ErrMalformedFeatures
+			return false
+		}
+		featureIndex -= s.indexBase
+		if featureIndex < 0 ||
+			(s.numFeatures > 0 && featureIndex >= s.numFeatures) {
+			s.err = ErrFeatureIndexOutOfBounds
+			return false
+		}
+
+		featureValue, err := strconv.ParseFloat(splitPair[1], mat.BitSize)
+		if err != nil {
+			s.err = ErrMalformedFeatures
+			return false
+		}
+
+		s.example.Features[i] = index_value.Pair{
+			Index: featureIndex,
+			Value: mat.Float(featureValue),
+		}
+	}
+
+	return true
+}
+
+// updateMaxIndices updates the highest feature index and label read so
+// far with the last example.
+func (s *Scanner) updateMaxIndices() {
+	for _, label := range s.example.Labels {
+		if label > s.maxLabel {
+			s.maxLabel = label
+		}
+	}
+	for _, pair := range s.example.Features {
+		if pair.Index > s.maxFeature {
+			s.maxFeature = pair.Index
+		}
+	}
+}
+
+// inferDimensions reads all the data, setting the missing dimensions
+// and the total points, and then resets the Scanner.
+func (s *Scanner) inferDimensions() {
+	if _, ok := s.r.(io.Seeker); !ok {
+		s.err = ErrNotSeekable
+		return
+	}
+
+	// the malformed lines are skipped, to be reported or skipped again
+	// when reading the data
+	lenient, name := s.lenient, s.name
+	s.SetLenient(dataset.NewLenient(1, 0, nil), "")
+	totalPoints := 0
+	for s.Scan() {
+		totalPoints++
+	}
+	s.SetLenient(lenient, name)
+	if s.Err() != nil {
+		return
+	}
+
+	if s.numFeatures <= 0 {
+		s.numFeatures = s.maxFeature + 1
+	}
+	if s.numLabels <= 0 {
+		s.numLabels = s.maxLabel + 1
+	}
+	s.totalPoints = totalPoints
+
+	s.err = s.Reset()
+}
+
+// binaryLabel maps the -1 and +1 labels of a binary dataset to 0 and 1,
+// and any other label to -1, out of bounds.
+func binaryLabel(label int) int {
+	switch label {
+	case -1:
+		return 0
+	case 1:
+		return 1
+	default:
+		return -1
+	}
+}
+
+// newLineScanner returns a bufio.Scanner for lines of any length,
+// rather than up to bufio.MaxScanTokenSize.
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	bufScanner := bufio.NewScanner(r)
+	bufScanner.Buffer(nil, math.MaxInt32)
+	return bufScanner
+}
@@ -0,0 +1,277 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libsvm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/dataset"
+)
+
+const testData = "# comment line\n" +
+	"0,2 qid:7 1:0.5 5:1 # trailing comment\n" +
+	"\n" +
+	"1\t3:2\n" +
+	"4:1.5\n"
+
+func TestScanner(t *testing.T) {
+	s := NewScanner(strings.NewReader(testData), 1, 10, 5)
+	assertIntEqual(t, s.TotalPoints(), 0, "TotalPoints")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	example := s.Example()
+	assertIntEqual(t, s.LineNumber(), 2, "LineNumber")
+	assertIntEqual(t, s.Qid(), 7, "Qid")
+	assertIntEqual(t, len(example.Labels), 2, "len(Labels)")
+	assertIntEqual(t, example.Labels[1], 2, "label")
+	assertIntEqual(t, len(example.Features), 2, "len(Features)")
+	assertIntEqual(t, example.Features[0].Index, 0, "1-based index")
+	assertIntEqual(t, example.Features[1].Index, 4, "1-based index")
+	if example.Features[1].Value != 1 {
+		t.Errorf("Assertion failed: value | expected 1, actual %g",
+			example.Features[1].Value)
+	}
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 4, "LineNumber")
+	assertIntEqual(t, s.Qid(), 0, "missing Qid")
+	assertIntEqual(t, s.Example().Features[0].Index, 2, "tab separated")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, len(s.Example().Labels), 0, "no labels")
+	assertIntEqual(t, s.Example().Features[0].Index, 3, "no labels")
+
+	if s.Scan() || s.Err() != nil {
+		t.Errorf("Expected EOF, got error %v", s.Err())
+	}
+}
+
+func TestScannerSignedLabels(t *testing.T) {
+	s := NewScanner(strings.NewReader("+1 1:1\n+0,+3 2:1\n"), 1, 10, 5)
+
+	expected := [][]int{{1}, {0, 3}}
+	for i, labels := range expected {
+		if !s.Scan() {
+			t.Fatalf("Scan failed: %v", s.Err())
+		}
+		assertIntEqual(t, len(s.Example().Labels), len(labels), "len(Labels)")
+		for j, label := range labels {
+			assertIntEqual(t, s.Example().Labels[j], label, "label")
+		}
+		assertIntEqual(t, s.LineNumber(), i+1, "LineNumber")
+	}
+}
+
+// binaryData is in the SVMlight format of binary datasets such as
+// heart_scale, with -1 and +1 labels and a trailing space.
+const binaryData = "+1 1:0.708333 2:1 3:1 4:-0.320755 5:-0.105023 6:-1 7:1 8:-0.419847 9:-1 10:-0.225806 12:1 13:-1 \n" +
+	"-1 1:0.583333 2:-1 3:0.333333 4:-0.603774 5:1 6:-1 7:1 8:0.358779 9:-1 10:-0.483871 12:-1 13:1 \n" +
+	"+1 1:0.166667 2:1 3:-0.333333 4:-0.433962 5:-0.383562 6:-1 7:-1 8:0.0687023 9:-1 10:-0.903226 11:-1 12:-1 13:1 \n" +
+	"-1 1:0.458333 2:1 3:1 4:-0.358491 5:-0.374429 6:-1 7:-1 8:-0.480916 9:1 10:-0.935484 12:-0.333333 13:1 \n"
+
+func TestBinaryScanner(t *testing.T) {
+	// the -1 labels are out of bounds, unless read as binary
+	s := NewScanner(strings.NewReader(binaryData), 1, 13, 2)
+	if s.Scan(); s.Err() != nil {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	if s.Scan() || s.Err() != ErrLabelOutOfBounds {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrLabelOutOfBounds, s.Err())
+	}
+
+	s = NewBinaryScanner(strings.NewReader(binaryData), 1, 0)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, s.TotalPoints(), 4, "TotalPoints")
+	assertIntEqual(t, s.NumFeatures(), 13, "NumFeatures")
+	assertIntEqual(t, s.NumLabels(), 2, "NumLabels")
+
+	for _, label := range []int{1, 0, 1, 0} {
+		if !s.Scan() {
+			t.Fatalf("Scan failed: %v", s.Err())
+		}
+		assertIntEqual(t, len(s.Example().Labels), 1, "len(Labels)")
+		assertIntEqual(t, s.Example().Labels[0], label, "label")
+	}
+	if s.Scan() || s.Err() != nil {
+		t.Errorf("Expected EOF, got error %v", s.Err())
+	}
+
+	s = NewBinaryScanner(strings.NewReader("+1 1:1\n0 1:1\n"), 1, 13)
+	for s.Scan() {
+	}
+	if s.Err() != ErrLabelOutOfBounds {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrLabelOutOfBounds, s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 2, "LineNumber")
+}
+
+func TestScannerLongLine(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("0")
+	for i := 1; i <= 100000; i++ {
+		fmt.Fprintf(&b, " %d:1", i)
+	}
+	b.WriteString("\n1 7:2.5\n")
+
+	s := NewScanner(strings.NewReader(b.String()), 1, 0, 0)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, s.NumFeatures(), 100000, "NumFeatures")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, len(s.Example().Features), 100000, "len(Features)")
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, s.Example().Features[0].Index, 6, "last line")
+
+	if s.Scan() || s.Err() != nil {
+		t.Errorf("Expected EOF, got error %v", s.Err())
+	}
+}
+
+func TestScannerInferDimensions(t *testing.T) {
+	s := NewScanner(strings.NewReader(testData), 0, 0, 0)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, s.TotalPoints(), 3, "TotalPoints")
+	assertIntEqual(t, s.NumFeatures(), 6, "NumFeatures")
+	assertIntEqual(t, s.NumLabels(), 3, "NumLabels")
+
+	if !s.Scan() {
+		t.Fatalf("Scan after inference failed: %v", s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 2, "LineNumber")
+
+	// the malformed lines are ignored by the inference, and reported
+	// when reading, against the dimensions of the other lines
+	s = NewScanner(strings.NewReader("0 1:1\n9 1:x\n1 2:1\n"), 1, 0, 0)
+	if err := s.Err(); err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, s.TotalPoints(), 2, "TotalPoints")
+	assertIntEqual(t, s.NumFeatures(), 2, "NumFeatures")
+	assertIntEqual(t, s.NumLabels(), 2, "NumLabels")
+	for s.Scan() {
+	}
+	if s.Err() != ErrLabelOutOfBounds {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrLabelOutOfBounds, s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 2, "LineNumber")
+
+	s = NewScanner(struct{ io.Reader }{strings.NewReader(testData)}, 1, 0, 5)
+	if s.Err() != ErrNotSeekable {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrNotSeekable, s.Err())
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+		err   error
+	}{
+		{"0 1:1\nx 1:1\n", 2, ErrMalformedLabels},
+		{"\n5 1:1\n", 2, ErrLabelOutOfBounds},
+		{"-1 1:1\n", 1, ErrLabelOutOfBounds},
+		{"0 qid:x 1:1\n", 1, ErrMalformedQid},
+		{"0 1-1\n", 1, ErrMalformedFeatures},
+		{"0 1:x\n", 1, ErrMalformedFeatures},
+		{"0 0:1\n", 1, ErrFeatureIndexOutOfBounds},
+		{"0 11:1\n", 1, ErrFeatureIndexOutOfBounds},
+	}
+
+	for _, test := range tests {
+		s := NewScanner(strings.NewReader(test.input), 1, 10, 5)
+		for s.Scan() {
+		}
+		if s.Err() != test.err {
+			t.Errorf("Assertion failed: %q | expected %v, actual %v",
+				test.input, test.err, s.Err())
+		}
+		assertIntEqual(t, s.LineNumber(), test.line, test.input)
+	}
+
+	// the errors of malformed examples are shared with the other formats
+	shared := map[error]error{
+		ErrMalformedLabels:         dataset.ErrMalformedLabels,
+		ErrMalformedFeatures:       dataset.ErrMalformedFeatures,
+		ErrLabelOutOfBounds:        dataset.ErrLabelOutOfBounds,
+		ErrFeatureIndexOutOfBounds: dataset.ErrFeatureIndexOutOfBounds,
+	}
+	for err, target := range shared {
+		if !errors.Is(err, target) {
+			t.Errorf("%v is not %v", err, target)
+		}
+	}
+}
+
+func TestScannerLenient(t *testing.T) {
+	const input = "0 1:1\n" +
+		"x 1:1\n" +
+		"# comment\n" +
+		"1 2:1\n" +
+		"9 1:1\n"
+
+	var quarantine strings.Builder
+	lenient := dataset.NewLenient(0.5, 0, &quarantine)
+	s := NewScanner(strings.NewReader(input), 1, 10, 5)
+	s.SetLenient(lenient, "data")
+
+	var labels []int
+	for s.Scan() {
+		labels = append(labels, s.Example().Labels[0])
+	}
+	if s.Err() != nil {
+		t.Fatalf("Unexpected error: %v", s.Err())
+	}
+	assertIntEqual(t, len(labels), 2, "examples")
+	assertIntEqual(t, labels[1], 1, "label")
+	assertIntEqual(t, lenient.NumSkipped(), 2, "NumSkipped")
+
+	// the errors are counted as the shared ones of all formats
+	var numMalformed int
+	for err, count := range lenient.Counts() {
+		if errors.Is(err, dataset.ErrMalformedLabels) ||
+			errors.Is(err, dataset.ErrLabelOutOfBounds) {
+			numMalformed += count
+		}
+	}
+	assertIntEqual(t, numMalformed, 2, "malformed examples")
+
+	expected := "data:2\t" + ErrMalformedLabels.Error() + "\tx 1:1\n" +
+		"data:5\t" + ErrLabelOutOfBounds.Error() + "\t9 1:1\n"
+	if quarantine.String() != expected {
+		t.Errorf("Assertion failed: expected %q, actual %q",
+			expected, quarantine.String())
+	}
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libsvm
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strconv"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// Writer writes a dataset, without query IDs.
+type Writer struct {
+	w         *bufio.Writer
+	buf       []byte
+	indexBase int
+}
+
+// ErrWriteEmptyExample is returned writing an example without labels
+// and features, which would be an empty line, skipped when reading.
+var ErrWriteEmptyExample = errors.New("libsvm.Writer: example without labels and features")
+
+var _ dataset.Writer = &Writer{}
+
+// NewWriter creates a Writer, with feature indices starting from
+// indexBase.
+func NewWriter(w io.Writer, indexBase int) *Writer {
+	return &Writer{
+		w:         bufio.NewWriter(w),
+		indexBase: indexBase,
+	}
+}
+
+// Write writes the next example.
+func (lw *Writer) Write(example dataset.Example) error {
+	if len(example.Labels) == 0 && len(example.Features) == 0 {
+		return ErrWriteEmptyExample
+	}
+
+	buf := lw.buf[:0]
+
+	for i, label := range example.Labels {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(label), 10)
+	}
+
+	for i, pair := range example.Features {
+		if i > 0 || len(example.Labels) > 0 {
+			buf = append(buf, ' ')
+		}
+		buf = strconv.AppendInt(buf, int64(pair.Index+lw.indexBase), 10)
+		buf = append(buf, ':')
+		buf = strconv.AppendFloat(buf, float64(pair.Value), 'g', -1, mat.BitSize)
+	}
+
+	buf = append(buf, '\n')
+	lw.buf = buf
+
+	_, err := lw.w.Write(buf)
+	return err
+}
+
+// Close flushes any buffered data to the underlying io.Writer. It
+// does not close the underlying io.Writer.
+func (lw *Writer) Close() error {
+	return lw.w.Flush()
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package libsvm
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 1)
+	w.Write(dataset.Example{
+		Features: []index_value.Pair{{Index: 0, Value: 0.5}, {Index: 4, Value: 1}},
+		Labels:   []int{0, 2},
+	})
+	w.Write(dataset.Example{
+		Features: []index_value.Pair{{Index: 3, Value: 1.5}},
+		Labels:   []int{},
+	})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "0,2 1:0.5 5:1\n4:1.5\n"
+	if buf.String() != expected {
+		t.Errorf("Assertion failed: expected %q, actual %q",
+			expected, buf.String())
+	}
+}
+
+func TestWriterEmptyExample(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, 1)
+	err := w.Write(dataset.Example{Labels: []int{}})
+	if err != ErrWriteEmptyExample {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrWriteEmptyExample, err)
+	}
+
+	// an example with labels only is not empty
+	if err := w.Write(dataset.Example{Labels: []int{3}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "3\n" {
+		t.Errorf("Assertion failed: expected %q, actual %q", "3\n", buf.String())
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import (
+	"context"
+	"fmt"
+)
+
+// ReadError is an error of a Reader, with the line where it occurred.
+type ReadError struct {
+	LineNumber int
+	Err        error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.LineNumber, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
+
+// Prefetcher reads batches of examples in a background goroutine, so
+// that reading and parsing overlap with their processing.
+type Prefetcher struct {
+	batches chan []Example
+	cancel  context.CancelFunc
+	done    chan struct{}
+	err     error // set before batches is closed
+}
+
+// NewPrefetcher starts reading batches of batchSize examples, up to
+// maxBatches, or until the end of the data if maxBatches is not
+// positive. The last batch can be partial.
+//
+// At most depth batches are buffered, waiting to be received. The
+// reader must not be used until the Prefetcher is closed.
+func NewPrefetcher(
+	ctx context.Context,
+	reader Reader,
+	batchSize int,
+	maxBatches int,
+	depth int,
+) *Prefetcher {
+	ctx, cancel := context.WithCancel(ctx)
+	p := &Prefetcher{
+		batches: make(chan []Example, depth),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go p.run(ctx, reader, batchSize, maxBatches)
+	return p
+}
+
+// Batches returns the channel of the read batches, which is closed
+// when there are no more batches, because of the end of the data, an
+// error or the cancellation of the context.
+func (p *Prefetcher) Batches() <-chan []Example {
+	return p.batches
+}
+
+// Err returns the error which stopped reading, as a *ReadError, or the
+// context error. It must be called after the batches channel is closed.
+func (p *Prefetcher) Err() error {
+	return p.err
+}
+
+// Close stops reading, and waits for the background goroutine to exit.
+func (p *Prefetcher) Close() {
+	p.cancel()
+	<-p.done
+}
+
+func (p *Prefetcher) run(
+	ctx context.Context,
+	reader Reader,
+	batchSize int,
+	maxBatches int,
+) {
+	defer close(p.done)
+	defer close(p.batches)
+
+	for i := 0; maxBatches <= 0 || i < maxBatches; i++ {
+		if err := ctx.Err(); err != nil {
+			p.err = err
+			return
+		}
+
+		batch := make([]Example, 0, batchSize)
+		for len(batch) < batchSize && reader.Scan() {
+			batch = append(batch, reader.Example())
+		}
+		if err := reader.Err(); err != nil {
+			p.err = &ReadError{LineNumber: reader.LineNumber(), Err: err}
+			return
+		}
+		if len(batch) == 0 {
+			return
+		}
+
+		select {
+		case p.batches <- batch:
+		case <-ctx.Done():
+			p.err = ctx.Err()
+			return
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// sliceReader reads the given number of examples, then fails with err
+// if not nil.
+type sliceReader struct {
+	numExamples int
+	err         error
+	position    int
+}
+
+func (r *sliceReader) Scan() bool {
+	if r.position >= r.numExamples {
+		return false
+	}
+	r.position++
+	return true
+}
+
+func (r *sliceReader) Example() Example {
+	return Example{Labels: []int{r.position - 1}}
+}
+
+func (r *sliceReader) Err() error {
+	if r.position >= r.numExamples {
+		return r.err
+	}
+	return nil
+}
+
+func (r *sliceReader) LineNumber() int  { return r.position }
+func (r *sliceReader) Reset() error     { r.position = 0; return nil }
+func (r *sliceReader) TotalPoints() int { return r.numExamples }
+func (r *sliceReader) NumFeatures() int { return 1 }
+func (r *sliceReader) NumLabels() int   { return r.numExamples }
+
+func TestPrefetcher(t *testing.T) {
+	p := NewPrefetcher(context.Background(), &sliceReader{numExamples: 7}, 3, 0, 1)
+	defer p.Close()
+
+	var sizes []int
+	next := 0
+	for batch := range p.Batches() {
+		sizes = append(sizes, len(batch))
+		for _, example := range batch {
+			assertIntEqual(t, example.Labels[0], next, "example order")
+			next++
+		}
+	}
+
+	if p.Err() != nil {
+		t.Fatal(p.Err())
+	}
+	assertIntEqual(t, len(sizes), 3, "number of batches")
+	assertIntEqual(t, sizes[2], 1, "partial batch")
+}
+
+func TestPrefetcherMaxBatches(t *testing.T) {
+	reader := &sliceReader{numExamples: 10}
+	p := NewPrefetcher(context.Background(), reader, 3, 2, 0)
+
+	numBatches := 0
+	for range p.Batches() {
+		numBatches++
+	}
+	p.Close()
+
+	assertIntEqual(t, numBatches, 2, "number of batches")
+	assertIntEqual(t, reader.position, 6, "examples read")
+}
+
+func TestPrefetcherError(t *testing.T) {
+	errRead := errors.New("read error")
+	p := NewPrefetcher(context.Background(),
+		&sliceReader{numExamples: 4, err: errRead}, 3, 0, 2)
+	defer p.Close()
+
+	numBatches := 0
+	for range p.Batches() {
+		numBatches++
+	}
+
+	// the partial batch read before the error is discarded
+	assertIntEqual(t, numBatches, 1, "number of batches")
+
+	var readErr *ReadError
+	if !errors.As(p.Err(), &readErr) || readErr.Err != errRead {
+		t.Fatalf("Assertion failed: expected ReadError, actual %v", p.Err())
+	}
+	assertIntEqual(t, readErr.LineNumber, 4, "LineNumber")
+}
+
+func TestPrefetcherCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := NewPrefetcher(ctx, &sliceReader{numExamples: 100}, 1, 0, 0)
+
+	<-p.Batches()
+	cancel()
+	for range p.Batches() {
+	}
+	p.Close()
+
+	if p.Err() != context.Canceled {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			context.Canceled, p.Err())
+	}
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
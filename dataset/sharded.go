@@ -0,0 +1,147 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import "io"
+
+// ShardedReader reads the examples of a dataset split in several shards,
+// in sequence.
+//
+// Each shard is opened when reached, and closed at its end. Reset opens
+// the first shard again, so that the shards do not need to be seekable,
+// e.g. when compressed.
+type ShardedReader struct {
+	names       []string
+	open        func(shard int) (Reader, io.Closer, error)
+	shard       int    // index of the current shard
+	reader      Reader // nil if the current shard is not open
+	closer      io.Closer
+	err         error
+	totalPoints int
+	numFeatures int
+	numLabels   int
+}
+
+// ShardError is an error reading the shard with the given name.
+type ShardError struct {
+	Name string
+	Err  error
+}
+
+func (e *ShardError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e *ShardError) Unwrap() error {
+	return e.Err
+}
+
+var _ Reader = &ShardedReader{}
+
+// NewShardedReader creates a ShardedReader of the shards with the given
+// names, using the open function to open the i-th shard, along with the
+// io.Closer to close it. The dimensions of the whole dataset are given,
+// since they depend on the format, and on how the shards are split.
+func NewShardedReader(
+	names []string,
+	open func(shard int) (Reader, io.Closer, error),
+	totalPoints, numFeatures, numLabels int,
+) *ShardedReader {
+	return &ShardedReader{
+		names:       names,
+		open:        open,
+		totalPoints: totalPoints,
+		numFeatures: numFeatures,
+		numLabels:   numLabels,
+	}
+}
+
+func (s *ShardedReader) Scan() bool {
+	for s.err == nil && s.shard < len(s.names) {
+		if s.reader == nil {
+			s.openShard()
+			continue
+		}
+		if s.reader.Scan() {
+			return true
+		}
+		if err := s.reader.Err(); err != nil {
+			s.err = &ShardError{Name: s.names[s.shard], Err: err}
+			return false
+		}
+		if err := s.closeShard(); err != nil {
+			s.err = &ShardError{Name: s.names[s.shard], Err: err}
+			return false
+		}
+		s.shard++
+	}
+	return false
+}
+
+func (s *ShardedReader) openShard() {
+	reader, closer, err := s.open(s.shard)
+	if err != nil {
+		s.err = &ShardError{Name: s.names[s.shard], Err: err}
+		return
+	}
+	s.reader, s.closer = reader, closer
+	if err := reader.Err(); err != nil {
+		s.err = &ShardError{Name: s.names[s.shard], Err: err}
+	}
+}
+
+func (s *ShardedReader) closeShard() error {
+	if s.reader == nil {
+		return nil
+	}
+	s.reader = nil
+	return s.closer.Close()
+}
+
+// Close closes the current shard, if open.
+func (s *ShardedReader) Close() error {
+	return s.closeShard()
+}
+
+func (s *ShardedReader) Example() Example {
+	if s.reader == nil {
+		return Example{}
+	}
+	return s.reader.Example()
+}
+
+// Err returns the first error encountered, as a *ShardError.
+func (s *ShardedReader) Err() error {
+	return s.err
+}
+
+// LineNumber returns the line number in the current shard.
+func (s *ShardedReader) LineNumber() int {
+	if s.reader == nil {
+		return 0
+	}
+	return s.reader.LineNumber()
+}
+
+// Reset closes the current shard, so that scanning restarts from the
+// first one.
+func (s *ShardedReader) Reset() error {
+	err := s.closeShard()
+	s.shard = 0
+	s.err = nil
+	return err
+}
+
+func (s *ShardedReader) TotalPoints() int {
+	return s.totalPoints
+}
+
+func (s *ShardedReader) NumFeatures() int {
+	return s.numFeatures
+}
+
+func (s *ShardedReader) NumLabels() int {
+	return s.numLabels
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"testing"
+)
+
+// closeCounter counts the calls to Close.
+type closeCounter int
+
+func (c *closeCounter) Close() error {
+	*c++
+	return nil
+}
+
+func TestShardedReader(t *testing.T) {
+	errRead := errors.New("read error")
+	shards := []*sliceReader{
+		{numExamples: 2}, {numExamples: 0}, {numExamples: 3, err: errRead}}
+	var opened, closed closeCounter
+	open := func(shard int) (Reader, io.Closer, error) {
+		opened++
+		shards[shard].Reset()
+		return shards[shard], &closed, nil
+	}
+	s := NewShardedReader([]string{"a", "b", "c"}, open, 5, 1, 3)
+
+	for pass := 0; pass < 2; pass++ {
+		var labels []int
+		for s.Scan() {
+			labels = append(labels, s.Example().Labels[0])
+		}
+		assertIntEqual(t, len(labels), 5, "examples")
+		assertIntEqual(t, labels[2], 0, "first example of the last shard")
+
+		var shardErr *ShardError
+		if !errors.As(s.Err(), &shardErr) || shardErr.Name != "c" ||
+			!errors.Is(s.Err(), errRead) {
+			t.Errorf("Assertion failed: unexpected error %v", s.Err())
+		}
+		assertIntEqual(t, s.LineNumber(), 3, "LineNumber")
+
+		if err := s.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assertIntEqual(t, int(opened), 6, "opened shards")
+	assertIntEqual(t, int(closed), 6, "closed shards")
+	assertIntEqual(t, s.TotalPoints(), 5, "TotalPoints")
+}
+
+func TestDecompress(t *testing.T) {
+	const data = "1 2 3\n"
+
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(data))
+	zw.Close()
+
+	tests := []struct {
+		input      []byte
+		compressed bool
+	}{
+		{compressed.Bytes(), true},
+		{[]byte(data), false},
+		{[]byte("1"), false},
+		{nil, false},
+	}
+
+	for _, test := range tests {
+		r, isCompressed, err := Decompress(bytes.NewReader(test.input))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if isCompressed != test.compressed {
+			t.Errorf("Assertion failed: %q | expected compressed %v",
+				test.input, test.compressed)
+		}
+		output, err := ioutil.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := string(test.input)
+		if test.compressed {
+			expected = data
+		}
+		if string(output) != expected {
+			t.Errorf("Assertion failed: expected %q, actual %q",
+				expected, output)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import "math/rand"
+
+// RandomAccess is implemented by readers which can read any example by
+// its index, from zero to TotalPoints() - 1.
+type RandomAccess interface {
+	At(i int) Example
+}
+
+// Shuffler is implemented by readers which read the examples in a
+// different random order at each epoch, derived from their seed and
+// the epoch, so that the order of any epoch can be reproduced.
+type Shuffler interface {
+	Reader
+	// ResetEpoch restarts reading, in the order of the given epoch.
+	// Reset advances to the next epoch.
+	ResetEpoch(epoch int) error
+}
+
+// PermutedReader reads all the examples of a dataset in a random
+// order, drawing a new permutation at each epoch.
+//
+// The examples are read with random access, when the underlying reader
+// implements RandomAccess, otherwise they are all loaded in memory.
+type PermutedReader struct {
+	reader       Reader
+	randomAccess RandomAccess
+	examples     []Example // loaded examples, without random access
+	permutation  []int
+	position     int
+	lineNumber   int
+	seed         int64
+	epoch        int
+	rng          *rand.Rand
+	err          error
+	example      Example
+}
+
+var _ Shuffler = &PermutedReader{}
+
+// NewPermutedReader creates a PermutedReader, loading the examples if
+// needed, which starts reading the first epoch. The given reader must
+// not be used afterwards.
+func NewPermutedReader(reader Reader, seed int64) *PermutedReader {
+	p := &PermutedReader{
+		reader: reader,
+		seed:   seed,
+		rng:    rand.New(rand.NewSource(epochSeed(seed, 0))),
+	}
+
+	numExamples := 0
+	if randomAccess, ok := reader.(RandomAccess); ok {
+		p.randomAccess = randomAccess
+		numExamples = reader.TotalPoints()
+	} else {
+		for reader.Scan() {
+			p.examples = append(p.examples, reader.Example())
+		}
+		if p.err = reader.Err(); p.err != nil {
+			p.lineNumber = reader.LineNumber()
+			return p
+		}
+		numExamples = len(p.examples)
+	}
+
+	p.permutation = make([]int, numExamples)
+	p.shuffle()
+	return p
+}
+
+func (p *PermutedReader) Scan() bool {
+	p.example = Example{}
+	if p.err != nil || p.position >= len(p.permutation) {
+		return false
+	}
+
+	i := p.permutation[p.position]
+	if p.randomAccess != nil {
+		p.example = p.randomAccess.At(i)
+		if p.err = p.reader.Err(); p.err != nil {
+			p.lineNumber = p.position + 1
+			return false
+		}
+	} else {
+		p.example = p.examples[i]
+	}
+	p.position++
+	p.lineNumber = p.position
+	return true
+}
+
+func (p *PermutedReader) Example() Example {
+	return p.example
+}
+
+func (p *PermutedReader) Err() error {
+	return p.err
+}
+
+// LineNumber returns the position of the last example in the current
+// permutation, or the line of the underlying reader where loading the
+// examples failed.
+func (p *PermutedReader) LineNumber() int {
+	return p.lineNumber
+}
+
+// Reset restarts reading, with the permutation of the next epoch.
+func (p *PermutedReader) Reset() error {
+	return p.ResetEpoch(p.epoch + 1)
+}
+
+// ResetEpoch restarts reading, with the permutation of the given epoch.
+func (p *PermutedReader) ResetEpoch(epoch int) error {
+	if p.err != nil {
+		return p.err
+	}
+	p.position = 0
+	p.lineNumber = 0
+	p.epoch = epoch
+	p.rng.Seed(epochSeed(p.seed, epoch))
+	p.shuffle()
+	return nil
+}
+
+func (p *PermutedReader) TotalPoints() int {
+	return len(p.permutation)
+}
+
+func (p *PermutedReader) NumFeatures() int {
+	return p.reader.NumFeatures()
+}
+
+func (p *PermutedReader) NumLabels() int {
+	return p.reader.NumLabels()
+}
+
+// Permutation returns the order of the examples in the current pass,
+// as indices of the underlying reader. It must not be modified.
+func (p *PermutedReader) Permutation() []int {
+	return p.permutation
+}
+
+// Reader returns the underlying reader, from which the examples of the
+// permutation can be read directly, when it has random access.
+func (p *PermutedReader) Reader() Reader {
+	return p.reader
+}
+
+// shuffle draws the permutation from the identity, so that it depends
+// only on the state of the random generator.
+func (p *PermutedReader) shuffle() {
+	for i := range p.permutation {
+		p.permutation[i] = i
+	}
+	p.rng.Shuffle(len(p.permutation), func(i, j int) {
+		p.permutation[i], p.permutation[j] = p.permutation[j], p.permutation[i]
+	})
+}
+
+// ShuffleBufferReader reads the examples of a dataset in a partially
+// random order, keeping a bounded buffer of examples read in advance,
+// from which each example is drawn at random.
+type ShuffleBufferReader struct {
+	reader  Reader
+	buffer  []Example
+	size    int
+	seed    int64
+	epoch   int
+	rng     *rand.Rand
+	example Example
+}
+
+var _ Shuffler = &ShuffleBufferReader{}
+
+// NewShuffleBufferReader creates a ShuffleBufferReader, buffering up to
+// size examples, which starts reading the first epoch. The given reader
+// must not be used afterwards.
+func NewShuffleBufferReader(reader Reader, size int, seed int64) *ShuffleBufferReader {
+	return &ShuffleBufferReader{
+		reader: reader,
+		buffer: make([]Example, 0, size),
+		size:   size,
+		seed:   seed,
+		rng:    rand.New(rand.NewSource(epochSeed(seed, 0))),
+	}
+}
+
+func (s *ShuffleBufferReader) Scan() bool {
+	s.example = Example{}
+
+	for len(s.buffer) < s.size && s.reader.Scan() {
+		s.buffer = append(s.buffer, s.reader.Example())
+	}
+	if s.reader.Err() != nil || len(s.buffer) == 0 {
+		return false
+	}
+
+	i := s.rng.Intn(len(s.buffer))
+	last := len(s.buffer) - 1
+	s.example = s.buffer[i]
+	s.buffer[i] = s.buffer[last]
+	s.buffer[last] = Example{}
+	s.buffer = s.buffer[:last]
+	return true
+}
+
+func (s *ShuffleBufferReader) Example() Example {
+	return s.example
+}
+
+func (s *ShuffleBufferReader) Err() error {
+	return s.reader.Err()
+}
+
+// LineNumber returns the line of the last example read by the
+// underlying reader, which is ahead of the last scanned example.
+func (s *ShuffleBufferReader) LineNumber() int {
+	return s.reader.LineNumber()
+}
+
+// Reset discards the buffered examples, and resets the underlying
+// reader, to read the next epoch.
+func (s *ShuffleBufferReader) Reset() error {
+	return s.ResetEpoch(s.epoch + 1)
+}
+
+// ResetEpoch discards the buffered examples, and resets the underlying
+// reader, to read the given epoch.
+func (s *ShuffleBufferReader) ResetEpoch(epoch int) error {
+	for i := range s.buffer {
+		s.buffer[i] = Example{}
+	}
+	s.buffer = s.buffer[:0]
+	s.epoch = epoch
+	s.rng.Seed(epochSeed(s.seed, epoch))
+	return s.reader.Reset()
+}
+
+func (s *ShuffleBufferReader) TotalPoints() int {
+	return s.reader.TotalPoints()
+}
+
+func (s *ShuffleBufferReader) NumFeatures() int {
+	return s.reader.NumFeatures()
+}
+
+func (s *ShuffleBufferReader) NumLabels() int {
+	return s.reader.NumLabels()
+}
+
+// epochSeed derives the seed of the random generator of an epoch from
+// the seed of a reader, mixing them with the SplitMix64 finalizer, so
+// that the seeds of nearby epochs are unrelated.
+func epochSeed(seed int64, epoch int) int64 {
+	z := uint64(seed) + uint64(epoch+1)*0x9e3779b97f4a7c15
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	return int64(z ^ z>>31)
+}
@@ -0,0 +1,165 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dataset
+
+import (
+	"errors"
+	"testing"
+)
+
+// randomAccessReader is a sliceReader which also implements
+// RandomAccess, without loading.
+type randomAccessReader struct {
+	sliceReader
+	accessed int
+}
+
+func (r *randomAccessReader) At(i int) Example {
+	r.accessed++
+	return Example{Labels: []int{i}}
+}
+
+func TestPermutedReader(t *testing.T) {
+	p := NewPermutedReader(&sliceReader{numExamples: 50}, 1)
+	assertIntEqual(t, p.TotalPoints(), 50, "TotalPoints")
+
+	first := readLabels(t, p)
+	assertPermutation(t, first, 50)
+	if err := p.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	second := readLabels(t, p)
+	assertPermutation(t, second, 50)
+	if equalInts(first, second) {
+		t.Error("Expected a different order at each pass")
+	}
+
+	other := NewPermutedReader(&sliceReader{numExamples: 50}, 1)
+	if !equalInts(readLabels(t, other), first) {
+		t.Error("Expected the same order with the same seed")
+	}
+}
+
+func TestPermutedReaderRandomAccess(t *testing.T) {
+	reader := &randomAccessReader{sliceReader: sliceReader{numExamples: 20}}
+	p := NewPermutedReader(reader, 1)
+	assertIntEqual(t, reader.position, 0, "examples loaded")
+
+	assertPermutation(t, readLabels(t, p), 20)
+	assertIntEqual(t, reader.accessed, 20, "examples accessed")
+}
+
+func TestPermutedReaderError(t *testing.T) {
+	errRead := errors.New("read error")
+	p := NewPermutedReader(&sliceReader{numExamples: 3, err: errRead}, 1)
+	if p.Err() != errRead || p.Reset() != errRead || p.Scan() {
+		t.Errorf("Assertion failed: expected %v, actual %v", errRead, p.Err())
+	}
+	assertIntEqual(t, p.LineNumber(), 3, "LineNumber")
+}
+
+func TestShuffleBufferReader(t *testing.T) {
+	s := NewShuffleBufferReader(&sliceReader{numExamples: 50}, 10, 1)
+
+	first := readLabels(t, s)
+	assertPermutation(t, first, 50)
+	for i, label := range first {
+		// an example can't be drawn before it enters the buffer
+		if label >= i+10 {
+			t.Errorf("Assertion failed: example %d drawn at %d", label, i)
+		}
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	second := readLabels(t, s)
+	assertPermutation(t, second, 50)
+	if equalInts(first, second) {
+		t.Error("Expected a different order at each pass")
+	}
+
+	other := NewShuffleBufferReader(&sliceReader{numExamples: 50}, 10, 1)
+	if !equalInts(readLabels(t, other), first) {
+		t.Error("Expected the same order with the same seed")
+	}
+}
+
+func TestShufflerEpochs(t *testing.T) {
+	shufflers := map[string]func() Shuffler{
+		"PermutedReader": func() Shuffler {
+			return NewPermutedReader(&sliceReader{numExamples: 50}, 1)
+		},
+		"ShuffleBufferReader": func() Shuffler {
+			return NewShuffleBufferReader(&sliceReader{numExamples: 50}, 10, 1)
+		},
+	}
+
+	for name, newShuffler := range shufflers {
+		s := newShuffler()
+		var epochs [][]int
+		for epoch := 0; epoch < 3; epoch++ {
+			if epoch > 0 {
+				if err := s.Reset(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			epochs = append(epochs, readLabels(t, s))
+		}
+
+		// the same epoch gives the same order twice, whatever the
+		// epochs read before, as when resuming a run
+		for _, epoch := range []int{1, 1, 0, 2} {
+			if err := s.ResetEpoch(epoch); err != nil {
+				t.Fatal(err)
+			}
+			if !equalInts(readLabels(t, s), epochs[epoch]) {
+				t.Errorf("%s: expected the same order at epoch %d", name, epoch)
+			}
+		}
+
+		resumed := newShuffler()
+		if err := resumed.ResetEpoch(2); err != nil {
+			t.Fatal(err)
+		}
+		if !equalInts(readLabels(t, resumed), epochs[2]) {
+			t.Errorf("%s: expected the same order resuming at epoch 2", name)
+		}
+	}
+}
+
+func readLabels(t *testing.T, r Reader) []int {
+	var labels []int
+	for r.Scan() {
+		labels = append(labels, r.Example().Labels[0])
+	}
+	if r.Err() != nil {
+		t.Fatal(r.Err())
+	}
+	return labels
+}
+
+func assertPermutation(t *testing.T, values []int, n int) {
+	assertIntEqual(t, len(values), n, "permutation length")
+	seen := make([]bool, n)
+	for _, v := range values {
+		if v < 0 || v >= n || seen[v] {
+			t.Fatalf("Assertion failed: not a permutation %v", values)
+		}
+		seen[v] = true
+	}
+}
+
+func equalInts(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
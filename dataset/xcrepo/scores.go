@@ -0,0 +1,272 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xcrepo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// A score matrix is written in the same sparse format of the datasets,
+// without the labels column. The header holds the number of points and
+// the number of labels, and each following line holds the scores of a
+// point as space-separated label:score pairs.
+
+// ScoreWriter writes a score matrix.
+type ScoreWriter struct {
+	w           io.Writer
+	bw          *bufio.Writer
+	buf         []byte
+	patchHeader bool
+	totalPoints int
+	numLabels   int
+	numPoints   int // number of written points
+}
+
+// Errors returned by ScoreWriter.
+var (
+	ErrScoreWriteSeekerRequired = errors.New("xcrepo.ScoreWriter: patching the header requires an io.WriteSeeker")
+	ErrScoreWritePointsMismatch = errors.New("xcrepo.ScoreWriter: number of points differs from the header")
+)
+
+// NewScoreWriter creates a ScoreWriter, writing the header for the
+// given number of points and labels.
+//
+// If the number of points is unknown, it can be given as zero, as for
+// NewWriter. The header is then written with a zero-padded placeholder,
+// which Close replaces with the number of written points, and w must
+// implement io.WriteSeeker, positioned at its beginning.
+func NewScoreWriter(w io.Writer, totalPoints, numLabels int) (*ScoreWriter, error) {
+	sw := &ScoreWriter{
+		w:           w,
+		bw:          bufio.NewWriter(w),
+		patchHeader: totalPoints <= 0,
+		totalPoints: nonNegative(totalPoints),
+		numLabels:   numLabels,
+	}
+	if _, ok := w.(io.WriteSeeker); sw.patchHeader && !ok {
+		return nil, ErrScoreWriteSeekerRequired
+	}
+	if err := sw.writeHeader(sw.bw); err != nil {
+		return nil, err
+	}
+	return sw, nil
+}
+
+// Write writes the scores of the next point, using the pairs index
+// as label.
+func (sw *ScoreWriter) Write(scores []index_value.Pair) error {
+	sw.buf = sw.buf[:0]
+	for i, pair := range scores {
+		if i > 0 {
+			sw.buf = append(sw.buf, ' ')
+		}
+		sw.buf = strconv.AppendInt(sw.buf, int64(pair.Index), 10)
+		sw.buf = append(sw.buf, ':')
+		sw.buf = strconv.AppendFloat(
+			sw.buf, float64(pair.Value), 'g', -1, mat.BitSize)
+	}
+	sw.buf = append(sw.buf, '\n')
+	sw.numPoints++
+	_, err := sw.bw.Write(sw.buf)
+	return err
+}
+
+// Flush writes any buffered data to the underlying io.Writer.
+func (sw *ScoreWriter) Flush() error {
+	return sw.bw.Flush()
+}
+
+// Close flushes any buffered data to the underlying io.Writer, and
+// patches the header if needed. It does not close the underlying
+// io.Writer.
+func (sw *ScoreWriter) Close() error {
+	if err := sw.bw.Flush(); err != nil {
+		return err
+	}
+	if !sw.patchHeader {
+		if sw.numPoints != sw.totalPoints {
+			return ErrScoreWritePointsMismatch
+		}
+		return nil
+	}
+
+	sw.totalPoints = sw.numPoints
+	ws := sw.w.(io.WriteSeeker)
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := sw.writeHeader(ws); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (sw *ScoreWriter) writeHeader(w io.Writer) error {
+	format := "%d %d\n"
+	if sw.patchHeader {
+		format = fmt.Sprintf("%%0%dd %%d\n", headerDigits)
+	}
+	_, err := fmt.Fprintf(w, format, sw.totalPoints, sw.numLabels)
+	return err
+}
+
+// ScoreScanner reads a score matrix. Lines can be of any length, and
+// their number must match the header.
+type ScoreScanner struct {
+	reader      *bufio.Reader
+	line        []byte // buffer for lines longer than the reader one
+	readErr     error
+	err         error
+	lineNumber  int
+	totalPoints int
+	numLabels   int
+	scores      []index_value.Pair
+}
+
+// Errors returned by ScoreScanner.
+var (
+	ErrMalformedScoresHeader = errors.New("xcrepo.ScoreScanner: malformed or missing header")
+	ErrMalformedScores       = errors.New("xcrepo.ScoreScanner: malformed scores")
+	ErrScoreLabelOutOfBounds = errors.New("xcrepo.ScoreScanner: label value out of bounds")
+	ErrScorePointsMismatch   = errors.New("xcrepo.ScoreScanner: number of points differs from the header")
+)
+
+func NewScoreScanner(r io.Reader) *ScoreScanner {
+	s := &ScoreScanner{
+		reader: bufio.NewReaderSize(r, 1<<16),
+	}
+	s.scanHeader()
+	return s
+}
+
+// Err returns the first non-EOF error that was encountered by the
+// ScoreScanner.
+func (s *ScoreScanner) Err() error {
+	if s.err != nil {
+		return s.err
+	}
+	return s.readErr
+}
+
+func (s *ScoreScanner) LineNumber() int {
+	return s.lineNumber
+}
+
+func (s *ScoreScanner) TotalPoints() int {
+	return s.totalPoints
+}
+
+func (s *ScoreScanner) NumLabels() int {
+	return s.numLabels
+}
+
+// Scores returns the scores of the last scanned point, in the order
+// they appear in the file.
+func (s *ScoreScanner) Scores() []index_value.Pair {
+	return s.scores
+}
+
+func (s *ScoreScanner) Scan() bool {
+	s.scores = nil
+
+	if s.Err() != nil {
+		return false
+	}
+
+	line, ok := s.readLine()
+	if !ok {
+		if s.readErr == nil && s.lineNumber-1 != s.totalPoints {
+			s.err = ErrScorePointsMismatch
+		}
+		return false
+	}
+	if s.lineNumber-1 > s.totalPoints {
+		s.err = ErrScorePointsMismatch
+		return false
+	}
+
+	pairs := strings.Fields(string(line))
+	s.scores = make([]index_value.Pair, len(pairs))
+
+	for i, pair := range pairs {
+		splitPair := strings.Split(pair, ":")
+		if len(splitPair) != 2 {
+			s.err = ErrMalformedScores
+			return false
+		}
+
+		label, err := strconv.Atoi(splitPair[0])
+		if err != nil {
+			s.err = ErrMalformedScores
+			return false
+		}
+		if label < 0 || label >= s.numLabels {
+			s.err = ErrScoreLabelOutOfBounds
+			return false
+		}
+
+		score, err := strconv.ParseFloat(splitPair[1], mat.BitSize)
+		if err != nil {
+			s.err = ErrMalformedScores
+			return false
+		}
+
+		s.scores[i] = index_value.Pair{Index: label, Value: mat.Float(score)}
+	}
+
+	return true
+}
+
+func (s *ScoreScanner) scanHeader() {
+	line, ok := s.readLine()
+	if !ok {
+		if s.readErr == nil {
+			s.err = ErrMalformedScoresHeader
+		}
+		return
+	}
+
+	values := strings.Split(string(line), " ")
+	if len(values) != 2 {
+		s.err = ErrMalformedScoresHeader
+		return
+	}
+
+	var ints [2]int
+	for i, value := range values {
+		var err error
+		ints[i], err = strconv.Atoi(value)
+		if err != nil || ints[i] < 0 {
+			s.err = ErrMalformedScoresHeader
+			return
+		}
+	}
+
+	s.totalPoints = ints[0]
+	s.numLabels = ints[1]
+}
+
+// readLine returns the next line, without the end-of-line marker.
+func (s *ScoreScanner) readLine() ([]byte, bool) {
+	line, buf, err := readLine(s.reader, s.line)
+	s.line = buf
+	if err != nil {
+		if err != io.EOF {
+			s.readErr = err
+		}
+		return nil, false
+	}
+	s.lineNumber++
+	return line, true
+}
@@ -0,0 +1,187 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xcrepo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/dataset/libsvm"
+	"github.com/nlpodyssey/goslide/index_value"
+)
+
+func TestScoreWriter(t *testing.T) {
+	var buf bytes.Buffer
+	sw, err := NewScoreWriter(&buf, 2, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sw.Write([]index_value.Pair{{Index: 3, Value: 0.5}, {Index: 0, Value: 0.25}})
+	sw.Write([]index_value.Pair{})
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "2 10\n3:0.5 0:0.25\n\n"
+	if buf.String() != expected {
+		t.Errorf("Assertion failed: expected %q, actual %q",
+			expected, buf.String())
+	}
+
+	if _, err := NewScoreWriter(&buf, 0, 10); err != ErrScoreWriteSeekerRequired {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrScoreWriteSeekerRequired, err)
+	}
+	sw, _ = NewScoreWriter(&buf, 2, 10)
+	sw.Write([]index_value.Pair{})
+	if err := sw.Close(); err != ErrScoreWritePointsMismatch {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrScoreWritePointsMismatch, err)
+	}
+}
+
+func TestScoreWriterLibSVMRoundTrip(t *testing.T) {
+	// with the dimensions given, the LibSVM scanner does not know the
+	// number of points, which is patched in the header once written
+	data := libsvm.NewScanner(strings.NewReader(
+		"1 1:0.5\n0,2 2:1\n+1 1:1 3:2\n"), 1, 3, 3)
+	assertIntEqual(t, data.TotalPoints(), 0, "TotalPoints of the data")
+
+	file, err := ioutil.TempFile("", "scores")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	sw, err := NewScoreWriter(file, data.TotalPoints(), data.NumLabels())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for data.Scan() {
+		scores := make([]index_value.Pair, 0, len(data.Example().Labels))
+		for _, label := range data.Example().Labels {
+			scores = append(scores, index_value.Pair{Index: label, Value: 1})
+		}
+		if err := sw.Write(scores); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if data.Err() != nil {
+		t.Fatal(data.Err())
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	s := NewScoreScanner(file)
+	assertIntEqual(t, s.TotalPoints(), 3, "TotalPoints")
+	assertIntEqual(t, s.NumLabels(), 3, "NumLabels")
+	var labels []int
+	for s.Scan() {
+		for _, pair := range s.Scores() {
+			labels = append(labels, pair.Index)
+		}
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 4, "LineNumber")
+	assertIntEqual(t, len(labels), 4, "labels")
+	for i, expected := range []int{1, 0, 2, 1} {
+		assertIntEqual(t, labels[i], expected, "label")
+	}
+}
+
+func TestScoreScanner(t *testing.T) {
+	s := NewScoreScanner(strings.NewReader("2 10\n3:0.5 0:0.25\n\n"))
+	assertIntEqual(t, s.TotalPoints(), 2, "TotalPoints")
+	assertIntEqual(t, s.NumLabels(), 10, "NumLabels")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	scores := s.Scores()
+	assertIntEqual(t, len(scores), 2, "len(scores)")
+	assertIntEqual(t, scores[0].Index, 3, "label")
+	if scores[1].Value != 0.25 {
+		t.Errorf("Assertion failed: score | expected 0.25, actual %g",
+			scores[1].Value)
+	}
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, len(s.Scores()), 0, "empty line")
+
+	if s.Scan() || s.Err() != nil {
+		t.Errorf("Expected EOF, got error %v", s.Err())
+	}
+}
+
+func TestScoreScannerLongLine(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("2 100000\n")
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&b, "%d:0.5 ", i)
+	}
+	b.WriteString("\r\n7:2.5") // no final newline
+
+	s := NewScoreScanner(strings.NewReader(b.String()))
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, len(s.Scores()), 100000, "len(scores)")
+	assertIntEqual(t, s.Scores()[99999].Index, 99999, "label")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, s.Scores()[0].Index, 7, "last line")
+	assertIntEqual(t, s.LineNumber(), 3, "LineNumber")
+
+	if s.Scan() || s.Err() != nil {
+		t.Errorf("Expected EOF, got error %v", s.Err())
+	}
+}
+
+func TestScoreScannerErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+	}{
+		{"", ErrMalformedScoresHeader},
+		{"2 10 3\n", ErrMalformedScoresHeader},
+		{"1 10\n3-0.5\n", ErrMalformedScores},
+		{"1 10\n3:x\n", ErrMalformedScores},
+		{"1 10\n10:0.5\n", ErrScoreLabelOutOfBounds},
+		{"0 10\n3:0.5\n", ErrScorePointsMismatch},
+		{"3 10\n3:0.5\n\n", ErrScorePointsMismatch},
+	}
+
+	for _, test := range tests {
+		s := NewScoreScanner(strings.NewReader(test.input))
+		for s.Scan() {
+		}
+		if s.Err() != test.err {
+			t.Errorf("Assertion failed: %q | expected %v, actual %v",
+				test.input, test.err, s.Err())
+		}
+	}
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xcrepo
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// Writer writes a dataset.
+type Writer struct {
+	w           io.Writer
+	bw          *bufio.Writer
+	buf         []byte
+	patchHeader bool
+	totalPoints int
+	numFeatures int
+	numLabels   int
+	numPoints   int // number of written points
+	maxFeature  int // highest feature index written so far
+	maxLabel    int // highest label written so far
+}
+
+// Errors returned by Writer.
+var (
+	ErrWriteSeekerRequired = errors.New("xcrepo.Writer: patching the header requires an io.WriteSeeker")
+	ErrWriteOutOfBounds    = errors.New("xcrepo.Writer: label or feature index out of bounds")
+	ErrWriteNoFeatures     = errors.New("xcrepo.Writer: example without features")
+	ErrWritePointsMismatch = errors.New("xcrepo.Writer: number of points differs from the header")
+)
+
+var _ dataset.Writer = &Writer{}
+
+// headerDigits is the width of each value of a header to be patched,
+// enough for any int64.
+const headerDigits = 19
+
+// NewWriter creates a Writer, writing the header with the given values.
+//
+// Unknown values can be given as zero. The header is then written with
+// zero-padded placeholders, which Close replaces with the number of
+// written points, and the highest feature index and label plus one.
+// In this case, w must implement io.WriteSeeker, and it must be
+// positioned at its beginning.
+func NewWriter(w io.Writer, totalPoints, numFeatures, numLabels int) (*Writer, error) {
+	xw := &Writer{
+		w:           w,
+		bw:          bufio.NewWriter(w),
+		patchHeader: totalPoints <= 0 || numFeatures <= 0 || numLabels <= 0,
+		totalPoints: totalPoints,
+		numFeatures: numFeatures,
+		numLabels:   numLabels,
+		maxFeature:  -1,
+		maxLabel:    -1,
+	}
+
+	if xw.patchHeader {
+		xw.totalPoints = nonNegative(totalPoints)
+		xw.numFeatures = nonNegative(numFeatures)
+		xw.numLabels = nonNegative(numLabels)
+	}
+
+	if _, ok := w.(io.WriteSeeker); xw.patchHeader && !ok {
+		return nil, ErrWriteSeekerRequired
+	}
+	if err := xw.writeHeader(xw.bw); err != nil {
+		return nil, err
+	}
+	return xw, nil
+}
+
+// Write writes the next example.
+func (xw *Writer) Write(example dataset.Example) error {
+	if len(example.Features) == 0 {
+		return ErrWriteNoFeatures
+	}
+
+	buf := xw.buf[:0]
+
+	for i, label := range example.Labels {
+		if label < 0 || (xw.numLabels > 0 && label >= xw.numLabels) {
+			return ErrWriteOutOfBounds
+		}
+		if label > xw.maxLabel {
+			xw.maxLabel = label
+		}
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = strconv.AppendInt(buf, int64(label), 10)
+	}
+
+	for _, pair := range example.Features {
+		if pair.Index < 0 ||
+			(xw.numFeatures > 0 && pair.Index >= xw.numFeatures) {
+			return ErrWriteOutOfBounds
+		}
+		if pair.Index > xw.maxFeature {
+			xw.maxFeature = pair.Index
+		}
+		buf = append(buf, ' ')
+		buf = strconv.AppendInt(buf, int64(pair.Index), 10)
+		buf = append(buf, ':')
+		buf = strconv.AppendFloat(buf, float64(pair.Value), 'g', -1, mat.BitSize)
+	}
+
+	buf = append(buf, '\n')
+	xw.buf = buf
+	xw.numPoints++
+
+	_, err := xw.bw.Write(buf)
+	return err
+}
+
+// Close flushes any buffered data to the underlying io.Writer, and
+// patches the header if needed. It does not close the underlying
+// io.Writer.
+func (xw *Writer) Close() error {
+	if err := xw.bw.Flush(); err != nil {
+		return err
+	}
+	if !xw.patchHeader {
+		if xw.numPoints != xw.totalPoints {
+			return ErrWritePointsMismatch
+		}
+		return nil
+	}
+
+	if xw.totalPoints > 0 && xw.numPoints != xw.totalPoints {
+		return ErrWritePointsMismatch
+	}
+	xw.totalPoints = xw.numPoints
+	if xw.numFeatures <= 0 {
+		xw.numFeatures = xw.maxFeature + 1
+	}
+	if xw.numLabels <= 0 {
+		xw.numLabels = xw.maxLabel + 1
+	}
+
+	ws := xw.w.(io.WriteSeeker)
+	if _, err := ws.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := xw.writeHeader(ws); err != nil {
+		return err
+	}
+	_, err := ws.Seek(0, io.SeekEnd)
+	return err
+}
+
+func (xw *Writer) writeHeader(w io.Writer) error {
+	format := "%d %d %d\n"
+	if xw.patchHeader {
+		format = fmt.Sprintf("%%0%[1]dd %%0%[1]dd %%0%[1]dd\n", headerDigits)
+	}
+	_, err := fmt.Fprintf(w, format, xw.totalPoints, xw.numFeatures, xw.numLabels)
+	return err
+}
+
+func nonNegative(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
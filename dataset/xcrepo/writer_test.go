@@ -0,0 +1,108 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xcrepo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+)
+
+var testExamples = []dataset.Example{
+	{
+		Features: []index_value.Pair{{Index: 1, Value: 0.5}, {Index: 4, Value: 1}},
+		Labels:   []int{0, 2},
+	},
+	{
+		Features: []index_value.Pair{{Index: 3, Value: 2}},
+		Labels:   []int{1},
+	},
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, 2, 5, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, example := range testExamples {
+		if err := w.Write(example); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf.String() != testData {
+		t.Errorf("Assertion failed: expected %q, actual %q",
+			testData, buf.String())
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	var buf bytes.Buffer
+	if _, err := NewWriter(&buf, 0, 5, 3); err != ErrWriteSeekerRequired {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrWriteSeekerRequired, err)
+	}
+
+	w, _ := NewWriter(&buf, 1, 4, 3)
+	if err := w.Write(testExamples[0]); err != ErrWriteOutOfBounds {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrWriteOutOfBounds, err)
+	}
+	if err := w.Write(dataset.Example{}); err != ErrWriteNoFeatures {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrWriteNoFeatures, err)
+	}
+	if err := w.Close(); err != ErrWritePointsMismatch {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrWritePointsMismatch, err)
+	}
+}
+
+func TestWriterPatchHeader(t *testing.T) {
+	file, err := ioutil.TempFile("", "xcrepo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w, err := NewWriter(file, 0, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, example := range testExamples {
+		if err := w.Write(example); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.Seek(0, 0); err != nil {
+		t.Fatal(err)
+	}
+	s := NewScanner(file)
+	assertIntEqual(t, s.TotalPoints(), 2, "TotalPoints")
+	assertIntEqual(t, s.NumFeatures(), 5, "NumFeatures")
+	assertIntEqual(t, s.NumLabels(), 10, "NumLabels")
+
+	numExamples := 0
+	for s.Scan() {
+		numExamples++
+	}
+	if s.Err() != nil {
+		t.Fatal(s.Err())
+	}
+	assertIntEqual(t, numExamples, 2, "examples")
+}
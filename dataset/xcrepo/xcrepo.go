@@ -10,43 +10,67 @@ package xcrepo
 
 import (
 	"bufio"
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
 	"strconv"
-	"strings"
+	"unsafe"
 
 	"github.com/nlpodyssey/goslide/dataset"
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
+// Scanner reads a dataset line by line, with no limit on the line
+// length.
+//
+// The examples are parsed in place from the read buffer. Their features
+// and labels are sub-slices of larger chunks of memory, allocated only
+// when the previous ones are full, so that examples remain valid after
+// the following calls to Scan.
 type Scanner struct {
-	bufScanner  *bufio.Scanner
+	r           io.Reader
+	reader      *bufio.Reader
+	line        []byte // buffer for lines longer than the reader buffer
 	err         error
+	readErr     error
 	lineNumber  int
 	totalPoints int
 	numFeatures int
 	numLabels   int
 	example     dataset.Example
+	features    []index_value.Pair // chunk of the next examples features
+	labels      []int              // chunk of the next examples labels
+	headerless  bool
+	lenient     *dataset.Lenient // nil to stop at the first malformed line
+	name        string           // of the data, for the lenient policy
 }
 
+// Minimum size of the chunks of features and labels.
+const (
+	featuresChunkSize = 1 << 16
+	labelsChunkSize   = 1 << 12
+)
+
 // Errors returned by Scanner.
 var (
 	ErrMalformedHeader         = errors.New("xcrepo.Scanner: malformed or missing header")
 	ErrNotEnoughFields         = errors.New("xcrepo.Scanner: not enough fields")
-	ErrMalformedLabels         = errors.New("xcrepo.Scanner: malformed labels")
+	ErrMalformedLabels         = fmt.Errorf("xcrepo.Scanner: %w", dataset.ErrMalformedLabels)
 	ErrMissingFeatures         = errors.New("xcrepo.Scanner: missing features")
-	ErrMalformedFeatures       = errors.New("xcrepo.Scanner: malformed features")
-	ErrLabelOutOfBounds        = errors.New("xcrepo.Scanner: label value out of bounds")
-	ErrFeatureIndexOutOfBounds = errors.New("xcrepo.Scanner: feature index out of bounds")
+	ErrMalformedFeatures       = fmt.Errorf("xcrepo.Scanner: %w", dataset.ErrMalformedFeatures)
+	ErrLabelOutOfBounds        = fmt.Errorf("xcrepo.Scanner: %w", dataset.ErrLabelOutOfBounds)
+	ErrFeatureIndexOutOfBounds = fmt.Errorf("xcrepo.Scanner: %w", dataset.ErrFeatureIndexOutOfBounds)
+	ErrNotSeekable             = errors.New("xcrepo.Scanner: reset requires an io.Seeker")
 )
 
+var _ dataset.LenientReader = &Scanner{}
+
 func NewScanner(r io.Reader) *Scanner {
 	s := &Scanner{
-		bufScanner: bufio.NewScanner(r),
-	}
-
-	if s.bufScanner.Err() != nil {
-		return s
+		r:      r,
+		reader: bufio.NewReaderSize(r, 1<<16),
 	}
 
 	s.scanHeader()
@@ -54,12 +78,60 @@ func NewScanner(r io.Reader) *Scanner {
 	return s
 }
 
+// NewHeaderlessScanner creates a Scanner for data without the header
+// line, such as the shards following the first one of a dataset with a
+// single global header. TotalPoints returns zero.
+func NewHeaderlessScanner(r io.Reader, numFeatures, numLabels int) *Scanner {
+	return &Scanner{
+		r:           r,
+		reader:      bufio.NewReaderSize(r, 1<<16),
+		numFeatures: numFeatures,
+		numLabels:   numLabels,
+		headerless:  true,
+	}
+}
+
+// SetLenient makes the Scanner skip the malformed lines, according to
+// the given policy, instead of stopping. The name identifies the data
+// in the policy quarantine. Errors reading the header or the input are
+// not skipped.
+func (s *Scanner) SetLenient(lenient *dataset.Lenient, name string) {
+	s.lenient = lenient
+	s.name = name
+}
+
 // Err returns the first non-EOF error that was encountered by the Scanner.
 func (s *Scanner) Err() error {
 	if s.err != nil {
 		return s.err
 	}
-	return s.bufScanner.Err()
+	return s.readErr
+}
+
+// Reset seeks the underlying reader to the beginning, and reads the
+// header again, if any. The reader must implement io.Seeker.
+func (s *Scanner) Reset() error {
+	seeker, ok := s.r.(io.Seeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+	if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	s.reader.Reset(s.r)
+	if s.lenient != nil {
+		s.lenient.Reset()
+	}
+	s.err = nil
+	s.readErr = nil
+	s.lineNumber = 0
+	s.example = dataset.Example{}
+	if !s.headerless {
+		s.scanHeader()
+	}
+
+	return s.Err()
 }
 
 func (s *Scanner) LineNumber() int {
@@ -90,40 +162,107 @@ func (s *Scanner) Scan() bool {
 		return false
 	}
 
-	if ok := s.bufScanner.Scan(); !ok || s.bufScanner.Err() != nil {
-		return false
+	for {
+		line, ok := s.readLine()
+		if !ok {
+			return false
+		}
+		if s.lenient != nil {
+			s.lenient.CountLine()
+		}
+		if s.parseLine(line) {
+			return true
+		}
+		if s.lenient == nil {
+			return false
+		}
+
+		err := s.lenient.Skip(s.name, s.lineNumber, line, s.err)
+		s.example = dataset.Example{}
+		s.err = err
+		if err != nil {
+			return false
+		}
 	}
-	s.lineNumber++
-	text := s.bufScanner.Text()
+}
 
-	values := strings.Split(text, " ")
-	if len(values) == 0 {
-		s.err = ErrNotEnoughFields
-		return false
+// parseLine parses an example, setting the error if malformed.
+func (s *Scanner) parseLine(line []byte) bool {
+	labels := line
+	var features []byte
+	if i := bytes.IndexByte(line, ' '); i >= 0 {
+		labels, features = line[:i], line[i+1:]
 	}
 
-	if ok := s.parseLabels(values[0]); !ok {
+	if ok := s.parseLabels(labels); !ok {
 		return false
 	}
-	if ok := s.parseFeatures(values[1:len(values)]); !ok {
+	if features == nil {
+		s.err = ErrMissingFeatures
 		return false
 	}
+	return s.parseFeatures(features)
+}
 
-	return true
+// readLine returns the next line, without the end-of-line marker. The
+// line is valid until the next read.
+func (s *Scanner) readLine() ([]byte, bool) {
+	line, buf, err := readLine(s.reader, s.line)
+	s.line = buf
+	if err != nil {
+		if err != io.EOF {
+			s.readErr = err
+		}
+		return nil, false
+	}
+	s.lineNumber++
+	return line, true
+}
+
+// readLine returns the next line read from r, without the end-of-line
+// marker, or io.EOF at the end of the input. Lines longer than the
+// buffer of r are joined in buf, which is returned to be reused by the
+// next call. The line is valid until the next read.
+func readLine(r *bufio.Reader, buf []byte) ([]byte, []byte, error) {
+	line, err := r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		buf = append(buf[:0], line...)
+		for err == bufio.ErrBufferFull {
+			line, err = r.ReadSlice('\n')
+			buf = append(buf, line...)
+		}
+		line = buf
+	}
+
+	if err != nil && err != io.EOF {
+		return nil, buf, err
+	}
+	if len(line) == 0 {
+		return nil, buf, io.EOF
+	}
+
+	if line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, buf, nil
 }
 
-func (s *Scanner) parseLabels(str string) bool {
-	if len(str) == 0 {
-		s.example.Labels = make([]int, 0)
-		return true
+func (s *Scanner) parseLabels(b []byte) bool {
+	n := 0
+	if len(b) > 0 {
+		n = bytes.Count(b, []byte{','}) + 1
 	}
+	labels := s.takeLabels(n)
 
-	labels := strings.Split(str, ",")
-	s.example.Labels = make([]int, len(labels))
+	for i := range labels {
+		var value []byte
+		value, b = nextField(b, ',')
 
-	for i, value := range labels {
-		label, err := strconv.Atoi(value)
-		if err != nil {
+		label, ok := parseInt(value)
+		if !ok {
 			s.err = ErrMalformedLabels
 			return false
 		}
@@ -131,77 +270,221 @@ func (s *Scanner) parseLabels(str string) bool {
 			s.err = ErrLabelOutOfBounds
 			return false
 		}
-		s.example.Labels[i] = label
+		labels[i] = label
 	}
+
+	s.example.Labels = labels
 	return true
 }
 
-func (s *Scanner) parseFeatures(pairs []string) bool {
-	lenPairs := len(pairs)
-	if lenPairs == 0 {
-		s.err = ErrMissingFeatures
-		return false
-	}
+func (s *Scanner) parseFeatures(b []byte) bool {
+	features := s.takeFeatures(bytes.Count(b, []byte{' '}) + 1)
 
-	s.example.Features = make([]index_value.Pair, lenPairs)
+	for i := range features {
+		var pair []byte
+		pair, b = nextField(b, ' ')
 
-	for i, pair := range pairs {
-		splitPair := strings.Split(pair, ":")
-		if len(splitPair) != 2 {
+		colon := bytes.IndexByte(pair, ':')
+		if colon < 0 {
 			s.err = ErrMalformedFeatures
 			return false
 		}
 
-		featureIndex, err := strconv.Atoi(splitPair[0])
-		if err != nil {
+		featureIndex, ok := parseInt(pair[:colon])
+		if !ok {
 			s.err = ErrMalformedFeatures
 			return false
 		}
-		if featureIndex < 0 || featureIndex >= s.NumFeatures() {
+		if featureIndex < 0 || featureIndex >= s.numFeatures {
 			s.err = ErrFeatureIndexOutOfBounds
 			return false
 		}
 
-		featureValue, err := strconv.ParseFloat(splitPair[1], 64)
-		if err != nil {
+		featureValue, ok := parseFloat(pair[colon+1:])
+		if !ok {
 			s.err = ErrMalformedFeatures
 			return false
 		}
 
-		s.example.Features[i] = index_value.Pair{
+		features[i] = index_value.Pair{
 			Index: featureIndex,
 			Value: featureValue,
 		}
 	}
 
+	s.example.Features = features
 	return true
 }
 
+// takeFeatures returns a slice of n features from the current chunk.
+func (s *Scanner) takeFeatures(n int) []index_value.Pair {
+	if n > len(s.features) {
+		s.features = make([]index_value.Pair, maxInt(n, featuresChunkSize))
+	}
+	features := s.features[:n:n]
+	s.features = s.features[n:]
+	return features
+}
+
+// takeLabels returns a slice of n labels from the current chunk.
+func (s *Scanner) takeLabels(n int) []int {
+	if n > len(s.labels) {
+		s.labels = make([]int, maxInt(n, labelsChunkSize))
+	}
+	labels := s.labels[:n:n]
+	s.labels = s.labels[n:]
+	return labels
+}
+
 func (s *Scanner) scanHeader() {
-	s.bufScanner.Scan()
-	if s.bufScanner.Err() != nil {
+	line, ok := s.readLine()
+	if s.readErr != nil {
 		return
 	}
-	s.lineNumber++
-	text := s.bufScanner.Text()
-
-	values := strings.Split(text, " ")
-	if len(values) != 3 {
+	if !ok {
 		s.err = ErrMalformedHeader
 		return
 	}
 
 	var ints [3]int
-	for i, value := range values {
-		var err error
-		ints[i], err = strconv.Atoi(value)
-		if err != nil || ints[i] <= 0 {
+	for i := range ints {
+		var value []byte
+		value, line = nextField(line, ' ')
+
+		var ok bool
+		ints[i], ok = parseInt(value)
+		if !ok || ints[i] <= 0 {
 			s.err = ErrMalformedHeader
 			return
 		}
 	}
+	if line != nil {
+		s.err = ErrMalformedHeader
+		return
+	}
 
 	s.totalPoints = ints[0]
 	s.numFeatures = ints[1]
 	s.numLabels = ints[2]
 }
+
+// nextField splits b at the first separator, returning the field before
+// it and the remainder after it, which is nil if there is no separator.
+func nextField(b []byte, separator byte) (field, rest []byte) {
+	i := bytes.IndexByte(b, separator)
+	if i < 0 {
+		return b, nil
+	}
+	return b[:i], b[i+1:]
+}
+
+// parseInt parses a base 10 integer, with an optional sign, like
+// strconv.Atoi, without allocating.
+func parseInt(b []byte) (int, bool) {
+	// up to 18 digits can't overflow
+	if len(b) > 18 {
+		n, err := strconv.Atoi(unsafeString(b))
+		return n, err == nil
+	}
+
+	negative := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		negative = b[0] == '-'
+		b = b[1:]
+	}
+	if len(b) == 0 {
+		return 0, false
+	}
+
+	n := 0
+	for _, c := range b {
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int(c-'0')
+	}
+
+	if negative {
+		return -n, true
+	}
+	return n, true
+}
+
+// parseFloat parses a floating-point number like strconv.ParseFloat,
+// without allocating.
+func parseFloat(b []byte) (mat.Float, bool) {
+	if f, ok := parseSimpleDecimal(b); ok {
+		return f, true
+	}
+	f, err := strconv.ParseFloat(unsafeString(b), mat.BitSize)
+	return mat.Float(f), err == nil
+}
+
+// maxExactMantissa and maxExactPow10 are the highest integer and power
+// of ten exactly representable as Float, so that the division of the
+// two gives a correctly rounded result.
+const (
+	maxExactMantissa = 1<<24 + (mat.BitSize/32-1)*(1<<53-1<<24) // 2^24 or 2^53
+	maxExactPow10    = 10 + (mat.BitSize/32-1)*12               // 10 or 22
+)
+
+var exactPow10 = [...]mat.Float{1e0, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8,
+	1e9, 1e10, 1e11, 1e12, 1e13, 1e14, 1e15, 1e16, 1e17, 1e18, 1e19, 1e20,
+	1e21, 1e22}
+
+// parseSimpleDecimal parses numbers like "-12.345", without exponent,
+// when the result is exact, or otherwise reports false.
+func parseSimpleDecimal(b []byte) (mat.Float, bool) {
+	// up to 19 digits can't overflow
+	if len(b) > 19 {
+		return 0, false
+	}
+
+	negative := false
+	if len(b) > 0 && (b[0] == '-' || b[0] == '+') {
+		negative = b[0] == '-'
+		b = b[1:]
+	}
+
+	var mantissa uint64
+	i := 0
+	for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+		mantissa = mantissa*10 + uint64(b[i]-'0')
+	}
+	numDigits := i
+
+	fractionDigits := 0
+	if i < len(b) && b[i] == '.' {
+		i++
+		start := i
+		for ; i < len(b) && b[i] >= '0' && b[i] <= '9'; i++ {
+			mantissa = mantissa*10 + uint64(b[i]-'0')
+		}
+		fractionDigits = i - start
+		numDigits += fractionDigits
+	}
+
+	if i != len(b) || numDigits == 0 || mantissa > maxExactMantissa ||
+		fractionDigits > maxExactPow10 {
+		return 0, false
+	}
+
+	f := mat.Float(mantissa) / exactPow10[fractionDigits]
+	if negative {
+		f = -f
+	}
+	return f, true
+}
+
+// unsafeString returns a string sharing the memory of b, which must
+// not be modified while the string is in use.
+func unsafeString(b []byte) string {
+	return *(*string)(unsafe.Pointer(&b))
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,275 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package xcrepo
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+const testData = "2 5 3\n" +
+	"0,2 1:0.5 4:1\n" +
+	"1 3:2\n"
+
+func TestScanner(t *testing.T) {
+	s := NewScanner(strings.NewReader(testData))
+	assertIntEqual(t, s.TotalPoints(), 2, "TotalPoints")
+	assertIntEqual(t, s.NumFeatures(), 5, "NumFeatures")
+	assertIntEqual(t, s.NumLabels(), 3, "NumLabels")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	example := s.Example()
+	assertIntEqual(t, len(example.Labels), 2, "len(Labels)")
+	assertIntEqual(t, example.Labels[1], 2, "label")
+	assertIntEqual(t, len(example.Features), 2, "len(Features)")
+	assertIntEqual(t, example.Features[1].Index, 4, "feature index")
+	assertIntEqual(t, s.LineNumber(), 2, "LineNumber")
+
+	if !s.Scan() || s.Scan() || s.Err() != nil {
+		t.Errorf("Expected two examples, got error %v", s.Err())
+	}
+}
+
+func TestScannerLongLine(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("2 100000 1\n0")
+	for i := 0; i < 100000; i++ {
+		fmt.Fprintf(&b, " %d:1", i)
+	}
+	b.WriteString("\r\n0 7:2.5") // no final newline
+
+	s := NewScanner(strings.NewReader(b.String()))
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	first := s.Example()
+	assertIntEqual(t, len(first.Features), 100000, "len(Features)")
+
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, s.Example().Features[0].Index, 7, "last line")
+	assertIntEqual(t, s.LineNumber(), 3, "LineNumber")
+
+	// the examples remain valid after scanning the following ones
+	assertIntEqual(t, first.Features[99999].Index, 99999, "first example")
+
+	if s.Scan() || s.Err() != nil {
+		t.Errorf("Expected EOF, got error %v", s.Err())
+	}
+}
+
+func TestScannerErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		line  int
+		err   error
+	}{
+		{"", 0, ErrMalformedHeader},
+		{"2 5\n", 1, ErrMalformedHeader},
+		{"2 5 3 1\n", 1, ErrMalformedHeader},
+		{"2 0 3\n", 1, ErrMalformedHeader},
+		{"1 5 3\n0\n", 2, ErrMissingFeatures},
+		{"1 5 3\n\n", 2, ErrMissingFeatures},
+		{"1 5 3\n0,x 1:1\n", 2, ErrMalformedLabels},
+		{"1 5 3\n0,,1 1:1\n", 2, ErrMalformedLabels},
+		{"1 5 3\n3 1:1\n", 2, ErrLabelOutOfBounds},
+		{"1 5 3\n0 1:1 2\n", 2, ErrMalformedFeatures},
+		{"1 5 3\n0 1:1  2:1\n", 2, ErrMalformedFeatures},
+		{"1 5 3\n0 1:1:1\n", 2, ErrMalformedFeatures},
+		{"1 5 3\n0 1:x\n", 2, ErrMalformedFeatures},
+		{"1 5 3\n0 -1:1\n", 2, ErrFeatureIndexOutOfBounds},
+		{"1 5 3\n0 1:1\n0 5:1\n", 3, ErrFeatureIndexOutOfBounds},
+	}
+
+	for _, test := range tests {
+		s := NewScanner(strings.NewReader(test.input))
+		for s.Scan() {
+		}
+		if s.Err() != test.err {
+			t.Errorf("Assertion failed: %q | expected %v, actual %v",
+				test.input, test.err, s.Err())
+		}
+		assertIntEqual(t, s.LineNumber(), test.line, test.input)
+	}
+
+	// the errors of malformed examples are shared with the other formats
+	shared := map[error]error{
+		ErrMalformedLabels:         dataset.ErrMalformedLabels,
+		ErrMalformedFeatures:       dataset.ErrMalformedFeatures,
+		ErrLabelOutOfBounds:        dataset.ErrLabelOutOfBounds,
+		ErrFeatureIndexOutOfBounds: dataset.ErrFeatureIndexOutOfBounds,
+	}
+	for err, target := range shared {
+		if !errors.Is(err, target) {
+			t.Errorf("%v is not %v", err, target)
+		}
+	}
+}
+
+func TestParseFloat(t *testing.T) {
+	inputs := []string{"0", "-0", "+1", "1.", ".5", "0.000123", "1e-3",
+		"-2.5E2", "123456789.123456789", "1234567890123456789012", "inf",
+		"NaN", "0x1p-2"}
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 10000; i++ {
+		inputs = append(inputs, strconv.FormatFloat(
+			r.NormFloat64()*float64(r.Intn(1000)), 'f', r.Intn(12), 64))
+	}
+
+	for _, input := range inputs {
+		expected, err := strconv.ParseFloat(input, mat.BitSize)
+		actual, ok := parseFloat([]byte(input))
+		if ok != (err == nil) || (ok && actual != mat.Float(expected) &&
+			!(math.IsNaN(float64(actual)) && math.IsNaN(expected))) {
+			t.Errorf("Assertion failed: %q | expected %g, actual %g",
+				input, expected, actual)
+		}
+	}
+
+	for _, input := range []string{"", "-", ".", "1.2.3", "1:2", "1 "} {
+		if _, ok := parseFloat([]byte(input)); ok {
+			t.Errorf("Assertion failed: %q | expected error", input)
+		}
+	}
+}
+
+func TestScannerReset(t *testing.T) {
+	s := NewScanner(bytes.NewReader([]byte(testData)))
+	for s.Scan() {
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	assertIntEqual(t, s.LineNumber(), 1, "LineNumber")
+	if !s.Scan() {
+		t.Fatalf("Scan failed: %v", s.Err())
+	}
+	assertIntEqual(t, s.Example().Labels[0], 0, "label")
+
+	s = NewScanner(struct{ io.Reader }{strings.NewReader(testData)})
+	if err := s.Reset(); err != ErrNotSeekable {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			ErrNotSeekable, err)
+	}
+}
+
+func TestScannerLenient(t *testing.T) {
+	const input = "5 5 3\n" +
+		"0 1:1\n" +
+		"3 1:1\n" +
+		"1 2:x\n" +
+		"2 4:1\n"
+
+	var quarantine strings.Builder
+	lenient := dataset.NewLenient(0.5, 5, &quarantine)
+	s := NewScanner(bytes.NewReader([]byte(input)))
+	s.SetLenient(lenient, "data")
+
+	var labels []int
+	for s.Scan() {
+		labels = append(labels, s.Example().Labels[0])
+	}
+	if s.Err() != nil {
+		t.Fatalf("Unexpected error: %v", s.Err())
+	}
+	assertIntEqual(t, len(labels), 2, "examples")
+	assertIntEqual(t, labels[1], 2, "label")
+	assertIntEqual(t, lenient.NumSkipped(), 2, "NumSkipped")
+	assertIntEqual(t, lenient.Counts()[ErrLabelOutOfBounds], 1,
+		"ErrLabelOutOfBounds")
+	assertIntEqual(t, lenient.Counts()[ErrMalformedFeatures], 1,
+		"ErrMalformedFeatures")
+
+	expected := "data:3\t" + ErrLabelOutOfBounds.Error() + "\t3 1:1\n" +
+		"data:4\t" + ErrMalformedFeatures.Error() + "\t1 2:x\n"
+	if quarantine.String() != expected {
+		t.Errorf("Assertion failed: expected %q, actual %q",
+			expected, quarantine.String())
+	}
+
+	// the lines are quarantined only once, and counted again
+	if err := s.Reset(); err != nil {
+		t.Fatal(err)
+	}
+	for s.Scan() {
+	}
+	assertIntEqual(t, lenient.NumSkipped(), 2, "NumSkipped after Reset")
+	if quarantine.String() != expected {
+		t.Errorf("Assertion failed: quarantined again %q", quarantine.String())
+	}
+
+	// 2 errors out of 5 lines are more than 20%
+	s = NewScanner(strings.NewReader(input))
+	s.SetLenient(dataset.NewLenient(0.2, 5, nil), "data")
+	for s.Scan() {
+	}
+	if s.Err() != dataset.ErrTooManyErrors {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			dataset.ErrTooManyErrors, s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 4, "LineNumber")
+}
+
+func TestScannerLenientUnknownTotal(t *testing.T) {
+	// without the total number of lines, the error rate is computed
+	// over the lines read so far
+	s := NewHeaderlessScanner(strings.NewReader(
+		"0 1:1\n2 4:1\n1 2:1\n0 3:1\n1 2:x\n"), 5, 3)
+	s.SetLenient(dataset.NewLenient(0.2, 0, nil), "data")
+	numExamples := 0
+	for s.Scan() {
+		numExamples++
+	}
+	if s.Err() != nil {
+		t.Fatalf("Unexpected error: %v", s.Err())
+	}
+	assertIntEqual(t, numExamples, 4, "examples")
+
+	// 1 error out of the first line is more than 20%
+	s = NewHeaderlessScanner(strings.NewReader("1 2:x\n0 1:1\n"), 5, 3)
+	s.SetLenient(dataset.NewLenient(0.2, 0, nil), "data")
+	for s.Scan() {
+	}
+	if s.Err() != dataset.ErrTooManyErrors {
+		t.Errorf("Assertion failed: expected %v, actual %v",
+			dataset.ErrTooManyErrors, s.Err())
+	}
+	assertIntEqual(t, s.LineNumber(), 1, "LineNumber")
+}
+
+func TestHeaderlessScanner(t *testing.T) {
+	s := NewHeaderlessScanner(bytes.NewReader([]byte("0 4:1\n2 1:2\n")), 5, 3)
+	for i := 0; i < 2; i++ {
+		var labels []int
+		for s.Scan() {
+			labels = append(labels, s.Example().Labels[0])
+		}
+		if s.Err() != nil {
+			t.Fatalf("Unexpected error: %v", s.Err())
+		}
+		assertIntEqual(t, len(labels), 2, "examples")
+		assertIntEqual(t, labels[1], 2, "label")
+		assertIntEqual(t, s.LineNumber(), 2, "LineNumber")
+		assertIntEqual(t, s.TotalPoints(), 0, "TotalPoints")
+
+		if err := s.Reset(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -13,6 +13,7 @@ import (
 	"time"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 type DensifiedMinhash struct {
@@ -40,7 +41,7 @@ func New(numHashes, numOfBitsToHash int) *DensifiedMinhash {
 
 func (dm *DensifiedMinhash) GetHash(
 	indices []int,
-	data []float64,
+	data []mat.Float,
 	binIds []int,
 ) []int {
 	hashes := make([]int, dm.numHashes)
@@ -138,7 +139,7 @@ func (dm *DensifiedMinhash) GetHashEasy(
 // TODO: avoid code duplication
 func (dm *DensifiedMinhash) GetHashEasyDense(
 	binIds []int,
-	data []float64,
+	data []mat.Float,
 	topK int,
 ) []int {
 	// Read the data and add it to priority queue O(dlogk approx 7d)
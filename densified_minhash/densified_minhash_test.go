@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 func TestDensifiedMinhashNew(t *testing.T) {
@@ -25,7 +26,7 @@ func TestWtaHashGetHash(t *testing.T) {
 	h := New(3, 10)
 	result := h.GetHash(
 		[]int{0, 1, 2, 0, 1, 2, 0, 1, 2, 0},
-		[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		[]mat.Float{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 		[]int{0, 1, 2},
 	)
 	assertIntEqual(t, len(result), 3, "len(result)")
@@ -50,7 +51,7 @@ func TestWtaHashGetHashEasyDense(t *testing.T) {
 	h := New(3, 10)
 	result := h.GetHashEasyDense(
 		[]int{0, 1, 2, 0, 1, 2, 0, 1, 2, 0},
-		[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		[]mat.Float{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 		8,
 	)
 	assertIntEqual(t, len(result), 3, "len(result)")
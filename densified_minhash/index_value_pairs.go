@@ -4,11 +4,15 @@
 
 package densified_minhash
 
-import "container/heap"
+import (
+	"container/heap"
+
+	"github.com/nlpodyssey/goslide/mat"
+)
 
 type indexValuePair struct {
 	index int
-	value float64
+	value mat.Float
 }
 
 type indexValuePriorityQueue []indexValuePair
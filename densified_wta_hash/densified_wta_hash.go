@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 // The number of times the range is larger than
@@ -75,7 +76,7 @@ func New(numHashes, numOfBitsToHash int) *DensifiedWtaHash {
 func (dw *DensifiedWtaHash) GetHash(data []index_value.Pair) []int {
 	type item struct {
 		hash  int
-		value float64
+		value mat.Float
 		init  bool
 	}
 
@@ -118,10 +119,10 @@ func (dw *DensifiedWtaHash) GetHash(data []index_value.Pair) []int {
 	return hashArray
 }
 
-func (dw *DensifiedWtaHash) GetHashEasy(data []float64, topK int) []int {
+func (dw *DensifiedWtaHash) GetHashEasy(data []mat.Float, topK int) []int {
 	hashes := make([]int, dw.numHashes)
 	hashArray := make([]int, dw.numHashes)
-	values := make([]float64, dw.numHashes)
+	values := make([]mat.Float, dw.numHashes)
 
 	for i := range hashes {
 		hashes[i] = math.MinInt64
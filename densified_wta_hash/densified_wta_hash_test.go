@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 func TestDensifiedWtaHashNew(t *testing.T) {
@@ -51,7 +52,7 @@ func TestDensifiedWtaHashGetHashEasy(t *testing.T) {
 	// Just ensure no error is raised
 	h := New(3, 10)
 	result := h.GetHashEasy(
-		[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		[]mat.Float{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
 		8,
 	)
 	assertIntEqual(t, len(result), 3, "len(result)")
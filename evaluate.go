@@ -0,0 +1,224 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"os"
+	"sort"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/dataset/csr"
+	"github.com/nlpodyssey/goslide/dataset/xcrepo"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/metrics"
+	"github.com/nlpodyssey/goslide/network"
+)
+
+// evaluateMetrics evaluates the top-k predictions of the network on the
+// test set, reporting the extreme classification metrics, and writing
+// the predictions to PredictionsFile, if set.
+func evaluateMetrics(myNet *network.Network, trainData, testData dataset.Reader) {
+	config := configuration.Global
+
+	k := maxInt(config.MetricsK)
+	if config.PredictionsFile != "" && config.PredictionsTopK > k {
+		k = config.PredictionsTopK
+	}
+	if k <= 0 {
+		return
+	}
+
+	resetDataset(testData)
+	evaluator := newEvaluator(trainData, testData.NumLabels())
+
+	var scoreWriter *xcrepo.ScoreWriter
+	if config.PredictionsFile != "" {
+		scoreFile, err := os.Create(config.PredictionsFile)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer scoreFile.Close()
+
+		// the number of points is patched once written, since it can
+		// be unknown, or smaller than the declared one when skipping
+		// malformed lines
+		scoreWriter, err = xcrepo.NewScoreWriter(
+			scoreFile, 0, numOutputs(config))
+		if err != nil {
+			logger.Fatal(err)
+		}
+	}
+
+	batches := prefetch(testData, 0)
+	defer batches.Close()
+
+	for {
+		examples := nextBatch(batches)
+		if len(examples) == 0 {
+			break
+		}
+
+		predictions := myNet.PredictTopKBatch(
+			examples, k, config.ExactPrediction)
+		for i, example := range examples {
+			evaluator.Add(predictions[i], example.Labels)
+			if scoreWriter == nil {
+				continue
+			}
+			scores := predictions[i]
+			if len(scores) > config.PredictionsTopK {
+				scores = scores[:config.PredictionsTopK]
+			}
+			if err := scoreWriter.Write(scores); err != nil {
+				logger.Fatal(err)
+			}
+		}
+	}
+
+	if scoreWriter != nil {
+		if err := scoreWriter.Close(); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Println("Predictions written to", config.PredictionsFile)
+	}
+
+	logMetrics(evaluator)
+}
+
+// evaluateScores reports the extreme classification metrics of the
+// scores read from a file, against the labels of the test set.
+func evaluateScores(scoreFilename string) {
+	config := configuration.Global
+
+	testData, testFile := openDataset(config.TestData)
+	defer testFile.Close()
+
+	scoreFile, err := os.Open(scoreFilename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	defer scoreFile.Close()
+
+	scoreScanner := xcrepo.NewScoreScanner(scoreFile)
+	if err := scoreScanner.Err(); err != nil {
+		logger.Fatal(err)
+	}
+	trainData, trainFile := openDataset(config.TrainData)
+	defer trainFile.Close()
+
+	evaluator := newEvaluator(trainData, testData.NumLabels())
+
+	sameLength := true
+	for testData.Scan() {
+		if !scoreScanner.Scan() {
+			sameLength = false
+			break
+		}
+		scores := scoreScanner.Scores()
+		sortByDecreasingValue(scores)
+		evaluator.Add(scores, testData.Example().Labels)
+	}
+
+	if err := testData.Err(); err != nil {
+		logger.Fatalf("Error at line %d. %v", testData.LineNumber(), err)
+	}
+	if err := scoreScanner.Err(); err != nil {
+		logger.Fatalf("Error at line %d of the score file. %v",
+			scoreScanner.LineNumber(), err)
+	}
+	if !sameLength || scoreScanner.Scan() {
+		logger.Fatal("Score file and test set have a different number of points.")
+	}
+
+	logMetrics(evaluator)
+}
+
+// newEvaluator creates an evaluator for a test set with numLabels
+// labels, with propensities estimated from the labels frequencies in
+// the training set.
+func newEvaluator(trainData dataset.Reader, numLabels int) *metrics.Evaluator {
+	config := configuration.Global
+
+	labelCounts, numExamples := countTrainingLabels(trainData)
+	// labels never seen in training, when the dimensions are inferred
+	for len(labelCounts) < numLabels {
+		labelCounts = append(labelCounts, 0)
+	}
+
+	invPropensities := metrics.InversePropensities(labelCounts, numExamples,
+		config.PropensityA, config.PropensityB)
+	return metrics.NewEvaluator(config.MetricsK, invPropensities)
+}
+
+// countTrainingLabels returns the number of training examples tagged
+// with each label, and the total number of training examples.
+func countTrainingLabels(trainData dataset.Reader) ([]int, int) {
+	if rows, ok := trainData.(*csr.Reader); ok {
+		return countRowLabels(rows)
+	}
+
+	resetDataset(trainData)
+
+	labelCounts := make([]int, trainData.NumLabels())
+	numExamples := 0
+	for trainData.Scan() {
+		for _, label := range trainData.Example().Labels {
+			labelCounts[label]++
+		}
+		numExamples++
+	}
+	if err := trainData.Err(); err != nil {
+		logger.Fatalf("Error at line %d. %v", trainData.LineNumber(), err)
+	}
+	return labelCounts, numExamples
+}
+
+// countRowLabels is like countTrainingLabels, but it reads the labels
+// of the memory-mapped examples in place, without copying the examples.
+func countRowLabels(trainData *csr.Reader) ([]int, int) {
+	labelCounts := make([]int, trainData.NumLabels())
+	for i := 0; i < trainData.TotalPoints(); i++ {
+		_, _, labels := trainData.Row(i)
+		for _, label := range labels {
+			labelCounts[label]++
+		}
+	}
+	return labelCounts, trainData.TotalPoints()
+}
+
+func logMetrics(evaluator *metrics.Evaluator) {
+	logger.Println("Metrics over", evaluator.NumExamples(), "examples")
+	for _, r := range evaluator.Results() {
+		logger.Printf("P@%d: %.4f  nDCG@%d: %.4f  PSP@%d: %.4f  PSnDCG@%d: %.4f\n",
+			r.K, r.Precision, r.K, r.NDCG, r.K, r.PSPrecision, r.K, r.PSNDCG)
+	}
+}
+
+// sortByDecreasingValue sorts the pairs by decreasing value, and by
+// increasing index on ties.
+func sortByDecreasingValue(pairs []index_value.Pair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].Value != pairs[j].Value {
+			return pairs[i].Value > pairs[j].Value
+		}
+		return pairs[i].Index < pairs[j].Index
+	})
+}
+
+// numOutputs returns the size of the output layer.
+func numOutputs(config *configuration.Configuration) int {
+	return config.SizesOfLayers[config.NumLayer-1]
+}
+
+func maxInt(values []int) int {
+	max := 0
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	return max
+}
@@ -5,6 +5,7 @@
 package main
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"runtime/pprof"
@@ -12,9 +13,11 @@ import (
 
 	"github.com/nlpodyssey/goslide/configuration"
 	"github.com/nlpodyssey/goslide/dataset"
-	"github.com/nlpodyssey/goslide/dataset/xcrepo"
 	"github.com/nlpodyssey/goslide/network"
 	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/quantization"
+	"github.com/nlpodyssey/goslide/schedule"
 )
 
 var logger = log.New(os.Stderr, "", 0)
@@ -22,10 +25,26 @@ var logger = log.New(os.Stderr, "", 0)
 var globalTime time.Duration
 
 func main() {
-	const cowId = 0
+	switch {
+	case len(os.Args) == 2:
+		loadGlobalConfiguration(os.Args[1])
+		train()
+	case len(os.Args) == 4 && os.Args[1] == "evaluate":
+		loadGlobalConfiguration(os.Args[2])
+		evaluateScores(os.Args[3])
+	case len(os.Args) > 2 && os.Args[1] == "convert":
+		convertDataset(os.Args[2:])
+	default:
+		logger.Println("Invalid or malformed arguments.")
+		logger.Fatal("\nUsage:\n" +
+			"  goslide <json_configuration_file>\n" +
+			"  goslide evaluate <json_configuration_file> <score_file>\n" +
+			"  goslide convert [flags] <input_file> <output_file>\n")
+	}
+}
 
-	validateArguments()
-	loadGlobalConfiguration()
+func train() {
+	const cowId = 0
 
 	config := configuration.Global
 
@@ -41,10 +60,18 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
+	trainData, trainFile := openDataset(config.TrainData)
+	defer trainFile.Close()
+	testData, testFile := openDataset(config.TestData)
+	defer testFile.Close()
+	resolveDimensions(trainData, testData)
+
 	// Initialize Network
 
-	numBatches := config.TotRecords / config.BatchSize
-	numBatchesTest := config.TotRecordsTest / config.BatchSize
+	// the last batch can be partial
+	numBatches := (config.TotRecords + config.BatchSize - 1) / config.BatchSize
+	numBatchesTest :=
+		(config.TotRecordsTest + config.BatchSize - 1) / config.BatchSize
 
 	if config.LoadWeight {
 		/*
@@ -54,6 +81,11 @@ func main() {
 		*/
 	}
 
+	learningRate, err := makeSchedule(config)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	startTime := time.Now()
 	myNet := network.New(
 		cowId,
@@ -61,7 +93,8 @@ func main() {
 		config.SizesOfLayers,
 		makeLayersTypes(config.NumLayer),
 		config.BatchSize,
-		config.LearningRate,
+		learningRate,
+		makeOptimizer(config),
 		config.InputDim,
 		config.K,
 		config.L,
@@ -71,21 +104,34 @@ func main() {
 	endTime := time.Now()
 	logger.Println("Network Initialization takes", endTime.Sub(startTime))
 
+	trainData = shuffleDataset(trainData)
+
 	// Start Training
 
+	var accuracy float64
 	for e := 0; e < config.Epoch; e++ {
-		logger.Println("Epoch", e)
+		logger.Println("Epoch", e,
+			"learning rate", myNet.LearningRate(e*numBatches))
 
-		trainSvmEpoch(cowId, numBatches, myNet, e)
+		trainSvmEpoch(cowId, numBatches, myNet, e, trainData, testData)
 
 		// test
 		if e == config.Epoch-1 {
-			evaluateSvm(cowId, numBatchesTest, myNet, (e+1)*numBatches)
+			accuracy = evaluateSvm(
+				cowId, numBatchesTest, myNet, (e+1)*numBatches, testData)
 		} else {
-			evaluateSvm(cowId, 50, myNet, (e+1)*numBatches)
+			accuracy = evaluateSvm(cowId, 50, myNet, (e+1)*numBatches, testData)
 		}
+		observeMetric(learningRate, accuracy)
+	}
+
+	if config.Quantization != configuration.NoQuantization {
+		evaluateQuantization(cowId, numBatchesTest, myNet,
+			config.Epoch*numBatches, accuracy, testData)
 	}
 
+	evaluateMetrics(myNet, trainData, testData)
+
 	if config.MemProfile {
 		f, err := os.Create("mem.prof")
 		if err != nil {
@@ -109,34 +155,144 @@ func makeLayersTypes(numLayers int) []node.NodeType {
 	return layersTypes
 }
 
-func trainSvmEpoch(cowId, numBatches int, myNet *network.Network, epoch int) {
-	config := configuration.Global
+func makeOptimizer(config *configuration.Configuration) optimizer.Optimizer {
+	switch config.Optimizer {
+	case configuration.SgdOptimizer:
+		return optimizer.NewSGD()
+	case configuration.MomentumOptimizer:
+		return optimizer.NewMomentum(config.Momentum)
+	case configuration.AdaGradOptimizer:
+		return optimizer.NewAdaGrad(config.Epsilon)
+	case configuration.RmsPropOptimizer:
+		return optimizer.NewRMSProp(config.Rho, config.Epsilon)
+	case configuration.AdamOptimizer:
+		return optimizer.NewAdam(config.Beta1, config.Beta2, config.Epsilon)
+	case configuration.AdamWOptimizer:
+		return optimizer.NewAdamW(
+			config.Beta1, config.Beta2, config.Epsilon, config.WeightDecay)
+	default:
+		logger.Fatalf("Unexpected optimizer %d.", config.Optimizer)
+		return nil
+	}
+}
 
-	file, err := os.Open(config.TrainData)
-	if err != nil {
-		logger.Fatal(err)
+func makeSchedule(config *configuration.Configuration) (schedule.Schedule, error) {
+	if err := validateSchedule(config); err != nil {
+		return nil, err
 	}
-	defer file.Close()
 
-	scanner := xcrepo.NewScanner(file)
-	if err := scanner.Err(); err != nil {
-		logger.Fatal(err)
+	var s schedule.Schedule
+
+	switch config.Schedule {
+	case configuration.ConstantSchedule:
+		s = schedule.NewConstant(config.LearningRate)
+	case configuration.StepDecaySchedule:
+		s = schedule.NewStepDecay(
+			config.LearningRate, config.DecayRate, config.DecaySteps)
+	case configuration.ExponentialSchedule:
+		s = schedule.NewExponential(
+			config.LearningRate, config.DecayRate, config.DecaySteps)
+	case configuration.CosineAnnealingSchedule:
+		s = schedule.NewCosineAnnealing(
+			config.LearningRate, config.MinLearningRate, config.DecaySteps)
+	case configuration.ReduceOnPlateauSchedule:
+		s = schedule.NewReduceOnPlateau(config.LearningRate,
+			config.DecayRate, config.MinLearningRate, config.Patience)
+	default:
+		return nil, fmt.Errorf(
+			"unexpected learning rate schedule %d", config.Schedule)
 	}
 
-	examples := make([]dataset.Example, 0, config.BatchSize)
+	if config.WarmupSteps > 0 {
+		s = schedule.NewLinearWarmup(s, config.WarmupSteps)
+	}
+	return s, nil
+}
 
-	for i := 0; i < numBatches; i++ {
-		if i > 0 && (i+epoch*numBatches)%config.Stepsize == 0 {
-			evaluateSvm(cowId, 20, myNet, epoch*numBatches+i)
+// validateSchedule checks the parameters used by the configured
+// learning rate schedule.
+func validateSchedule(config *configuration.Configuration) error {
+	switch config.Schedule {
+	case configuration.StepDecaySchedule,
+		configuration.ExponentialSchedule,
+		configuration.CosineAnnealingSchedule:
+		if config.DecaySteps <= 0 {
+			return fmt.Errorf("DecaySteps must be positive, got %d",
+				config.DecaySteps)
 		}
+	}
+
+	switch config.Schedule {
+	case configuration.StepDecaySchedule,
+		configuration.ExponentialSchedule,
+		configuration.ReduceOnPlateauSchedule:
+		if !(config.DecayRate > 0 && config.DecayRate <= 1) {
+			return fmt.Errorf("DecayRate must be in (0, 1], got %g",
+				config.DecayRate)
+		}
+	}
+	return nil
+}
+
+func makeQuantizer(config *configuration.Configuration) quantization.Quantizer {
+	switch config.Quantization {
+	case configuration.Bfloat16Quantization:
+		return quantization.NewBFloat16Vector
+	case configuration.Int8Quantization:
+		return quantization.NewInt8Vector
+	default:
+		logger.Fatalf("Unexpected quantization %d.", config.Quantization)
+		return nil
+	}
+}
 
-		examples = examples[:0]
-		for count := 0; count < config.BatchSize && scanner.Scan(); count++ {
-			examples = append(examples, scanner.Example())
+// evaluateQuantization evaluates a quantized copy of the trained
+// network on the test set, reporting the accuracy delta against the
+// full-precision one.
+func evaluateQuantization(
+	cowId, numBatchesTest int,
+	myNet *network.Network,
+	iter int,
+	fullAccuracy float64,
+	testData dataset.Reader,
+) {
+	config := configuration.Global
+
+	startTime := time.Now()
+	quantizedNet := myNet.Quantize(makeQuantizer(config))
+	logger.Println("Network Quantization takes", time.Since(startTime))
+
+	accuracy := evaluateSvm(cowId, numBatchesTest, quantizedNet, iter, testData)
+	logger.Printf("Quantized accuracy: %g (full precision %g, delta %+g)\n",
+		accuracy, fullAccuracy, accuracy-fullAccuracy)
+}
+
+func observeMetric(s schedule.Schedule, metric float64) {
+	if o, ok := s.(schedule.MetricObserver); ok {
+		o.Observe(metric)
+	}
+}
+
+func trainSvmEpoch(
+	cowId, numBatches int,
+	myNet *network.Network,
+	epoch int,
+	trainData, testData dataset.Reader,
+) {
+	config := configuration.Global
+
+	resetEpoch(trainData, epoch)
+	batches := trainingBatches(trainData, numBatches)
+	defer batches.Close()
+
+	for i := 0; i < numBatches; i++ {
+		if i > 0 && (i+epoch*numBatches)%config.Stepsize == 0 {
+			evaluateSvm(cowId, 20, myNet, epoch*numBatches+i, testData)
 		}
 
-		if err := scanner.Err(); err != nil {
-			logger.Fatalf("Error at line %d. %v", scanner.LineNumber(), err)
+		examples := batches.Next()
+		if len(examples) == 0 {
+			break
 		}
 
 		rehash := false
@@ -163,40 +319,33 @@ func trainSvmEpoch(cowId, numBatches int, myNet *network.Network, epoch int) {
 	}
 }
 
-func evaluateSvm(cowId, numBatchesTest int, myNet *network.Network, iter int) {
-	config := configuration.Global
-
+func evaluateSvm(
+	cowId, numBatchesTest int,
+	myNet *network.Network,
+	iter int,
+	testData dataset.Reader,
+) float64 {
 	totCorrect := 0
+	totExamples := 0
 
-	file, err := os.Open(config.TestData)
-	if err != nil {
-		logger.Fatal(err)
-	}
-	defer file.Close()
-
-	scanner := xcrepo.NewScanner(file)
-	if err := scanner.Err(); err != nil {
-		logger.Fatal(err)
-	}
-
-	examples := make([]dataset.Example, 0, config.BatchSize)
+	resetDataset(testData)
+	batches := prefetch(testData, numBatchesTest)
+	defer batches.Close()
 
 	for i := 0; i < numBatchesTest; i++ {
+		examples := nextBatch(batches)
+		if len(examples) == 0 {
+			break
+		}
+
 		numFeatures := 0
 		numLabels := 0
-		examples = examples[:0]
-		for count := 0; count < config.BatchSize && scanner.Scan(); count++ {
-			example := scanner.Example()
-			examples = append(examples, example)
+		for _, example := range examples {
 			numFeatures += len(example.Features)
 			numLabels += len(example.Labels)
 		}
 
-		if err := scanner.Err(); err != nil {
-			logger.Fatalf("Error at line %d. %v", scanner.LineNumber(), err)
-		}
-
-		logger.Println(config.BatchSize, "records, with", numFeatures,
+		logger.Println(len(examples), "records, with", numFeatures,
 			"features and", numLabels, "labels")
 
 		var correctPredict int
@@ -205,29 +354,26 @@ func evaluateSvm(cowId, numBatchesTest int, myNet *network.Network, iter int) {
 		correctPredict, myNet = myNet.PredictClass(cowId, examples)
 
 		totCorrect += correctPredict
+		totExamples += len(examples)
 
 		logger.Println("Iter", i, "-",
-			float64(totCorrect)/(float64(config.BatchSize)*(float64(i)+1)),
-			"correct")
+			float64(totCorrect)/float64(totExamples), "correct")
+	}
+
+	accuracy := 0.0
+	if totExamples > 0 {
+		accuracy = float64(totCorrect) / float64(totExamples)
 	}
 
-	logger.Println("Over all:",
-		float64(totCorrect)/(float64(numBatchesTest)*float64(config.BatchSize)),
-		"correct")
+	logger.Println("Over all:", accuracy, "correct")
 
-	logger.Println(iter, globalTime,
-		float64(totCorrect)/(float64(numBatchesTest)*float64(config.BatchSize)))
-}
+	logger.Println(iter, globalTime, accuracy,
+		"learning rate", myNet.LearningRate(iter))
 
-func validateArguments() {
-	if len(os.Args) != 2 {
-		logger.Println("Invalid or malformed arguments.")
-		logger.Fatal("\nUsage:\n  goslide <json_configuration_file>\n")
-	}
+	return accuracy
 }
 
-func loadGlobalConfiguration() {
-	configFilename := os.Args[1]
+func loadGlobalConfiguration(configFilename string) {
 	config, err := configuration.FromJsonFile(configFilename)
 
 	if err != nil {
@@ -4,7 +4,9 @@
 
 package index_value
 
+import "github.com/nlpodyssey/goslide/mat"
+
 type Pair struct {
 	Index int
-	Value float64
+	Value mat.Float
 }
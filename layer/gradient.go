@@ -0,0 +1,134 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layer
+
+import (
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+)
+
+// Checkpoint is a copy of the layer trainable parameters and optimizer
+// state, which can be restored later.
+type Checkpoint struct {
+	nodes *node.Snapshot
+}
+
+// ActivationsAreFinite reports whether the activations of the given
+// active nodes, and the softmax normalization constant of the given
+// input, are all neither NaN nor infinite.
+func (l *Layer) ActivationsAreFinite(
+	activeNodes []index_value.Pair,
+	inputId int,
+) bool {
+	if l.nodeType == node.Softmax &&
+		!mat.IsFinite(l.normalizationConstants[inputId]) {
+		return false
+	}
+	for _, pair := range activeNodes {
+		if !mat.IsFinite(pair.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// GradientSquaredNorm returns the squared L2 norm of the gradients
+// accumulated during the current batch.
+func (l *Layer) GradientSquaredNorm() mat.Float {
+	var sum mat.Float = 0
+	l.forEachNodeWithGradients(func(n node.Node) {
+		sum += n.GradientSquaredNorm()
+	})
+	return sum
+}
+
+// ClipGradients rescales the gradients of each node separately,
+// so that their L2 norm does not exceed maxNorm.
+func (la *Layer) ClipGradients(cowId int, maxNorm mat.Float) *Layer {
+	l := la.cloneIfNeeded(cowId)
+	l.forEachNodeWithGradients(func(n node.Node) {
+		n.ClipGradients(maxNorm)
+	})
+	return l
+}
+
+func (la *Layer) ScaleGradients(cowId int, factor mat.Float) *Layer {
+	l := la.cloneIfNeeded(cowId)
+	l.forEachNodeWithGradients(func(n node.Node) {
+		n.ScaleGradients(factor)
+	})
+	return l
+}
+
+// DiscardGradients resets the gradients accumulated during the current
+// batch, without updating the parameters.
+func (la *Layer) DiscardGradients(cowId int) *Layer {
+	l := la.cloneIfNeeded(cowId)
+	l.forEachNodeWithGradients(func(n node.Node) {
+		n.DiscardGradients()
+		l.isTouchedNode[n.Id()] = false
+	})
+	l.touchedNodes = l.touchedNodes[:0]
+	return l
+}
+
+// UpdatesAreFinite reports whether ApplyGradients, with the same
+// arguments, would result in finite parameters. Only the nodes and
+// weights which would be updated are checked, and nothing is changed.
+func (l *Layer) UpdatesAreFinite(
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	iter int,
+) bool {
+	finite := true
+	l.forEachNodeWithGradients(func(n node.Node) {
+		finite = finite &&
+			n.UpdateIsFinite(opt, learningRate, iter, l.regularization)
+	})
+	return finite
+}
+
+func (l *Layer) Checkpoint() *Checkpoint {
+	return l.SaveCheckpoint(nil)
+}
+
+// SaveCheckpoint copies the parameters and optimizer state into c,
+// reusing its buffers, or into a new checkpoint if nil, and returns it.
+func (l *Layer) SaveCheckpoint(c *Checkpoint) *Checkpoint {
+	if c == nil {
+		c = &Checkpoint{}
+	}
+	c.nodes = l.nodes.SaveSnapshot(c.nodes)
+	return c
+}
+
+// Restore sets the parameters and optimizer state from a checkpoint of
+// the same layer. Gradients are discarded.
+//
+// Hash tables are not changed, and they will reflect the restored
+// weights only after the next rehash.
+func (la *Layer) Restore(cowId int, c *Checkpoint) *Layer {
+	l := la.DiscardGradients(cowId)
+	l.nodes.Restore(c.nodes)
+	return l
+}
+
+// forEachNodeWithGradients calls fn for each node which may have
+// received a gradient during the current batch: only the touched
+// nodes with sparse updates, or all of them otherwise.
+func (l *Layer) forEachNodeWithGradients(fn func(n node.Node)) {
+	if configuration.Global.SparseUpdates {
+		for _, nodeId := range l.touchedNodes {
+			fn(l.nodes.Node(nodeId))
+		}
+		return
+	}
+	for nodeId := 0; nodeId < l.nodes.NumNodes(); nodeId++ {
+		fn(l.nodes.Node(nodeId))
+	}
+}
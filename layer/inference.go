@@ -0,0 +1,82 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layer
+
+import (
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/node"
+)
+
+// Scratch is reusable memory for the inference of a single example.
+// Its zero value is ready to use.
+type Scratch struct {
+	activeNodes []index_value.Pair
+	counts      []int
+}
+
+// ComputeActivations returns the active nodes for a single input, with
+// their activations as values. For the softmax layer, the values are
+// the normalized probabilities of the active nodes.
+//
+// The layer is not changed, so that it can be called concurrently,
+// as long as each call uses its own scratch. The returned slice belongs
+// to scratch, and it is valid until the scratch is used again.
+func (l *Layer) ComputeActivations(
+	input []index_value.Pair,
+	sparsity float64,
+	scratch *Scratch,
+) []index_value.Pair {
+	active, _ := l.selectActiveNodes(scratch, input, nil, sparsity)
+
+	var maxValue mat.Float = 0
+	for i, pair := range active {
+		n := l.nodes.Node(pair.Index)
+		if l.quantized != nil {
+			active[i].Value = n.QuantizedActivation(input, l.quantized[pair.Index])
+		} else {
+			active[i].Value = n.Activation(input)
+		}
+		if i == 0 || active[i].Value > maxValue {
+			maxValue = active[i].Value
+		}
+	}
+
+	if l.nodeType != node.Softmax {
+		return active
+	}
+
+	var sum mat.Float = 0
+	for i, pair := range active {
+		active[i].Value = mat.Exp(pair.Value - maxValue)
+		sum += active[i].Value
+	}
+	for i := range active {
+		active[i].Value /= sum
+	}
+	return active
+}
+
+// pairs returns a slice of n zero-valued pairs.
+func (s *Scratch) pairs(n int) []index_value.Pair {
+	if cap(s.activeNodes) < n {
+		s.activeNodes = make([]index_value.Pair, n)
+		return s.activeNodes
+	}
+	s.activeNodes = s.activeNodes[:n]
+	for i := range s.activeNodes {
+		s.activeNodes[i] = index_value.Pair{}
+	}
+	return s.activeNodes
+}
+
+// ints returns a slice of n integers, with undefined values.
+func (s *Scratch) ints(n int) []int {
+	if cap(s.counts) < n {
+		s.counts = make([]int, n)
+	}
+	s.counts = s.counts[:n]
+	return s.counts
+}
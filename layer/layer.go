@@ -16,7 +16,10 @@ import (
 	"github.com/nlpodyssey/goslide/densified_wta_hash"
 	"github.com/nlpodyssey/goslide/index_value"
 	"github.com/nlpodyssey/goslide/lsh"
+	"github.com/nlpodyssey/goslide/mat"
 	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/quantization"
 	"github.com/nlpodyssey/goslide/sparse_random_projection"
 	"github.com/nlpodyssey/goslide/wta_hash"
 )
@@ -31,11 +34,12 @@ const mapLen = 325_056
 type Layer struct {
 	cowId                   int // "thread" ID for copy on write
 	nodeType                node.NodeType
-	nodes                   []*node.Node
+	nodes                   *node.Storage
 	randNode                []int
-	normalizationConstants  []float64
+	normalizationConstants  []mat.Float
 	k                       int
 	l                       int
+	rangePow                int
 	previousLayerNumOfNodes int
 	hashTables              *lsh.LSH
 	wtaHasher               *wta_hash.WtaHash
@@ -43,6 +47,12 @@ type Layer struct {
 	srp                     *sparse_random_projection.SparseRandomProjection
 	dwtaHasher              *densified_wta_hash.DensifiedWtaHash
 	binIds                  []int
+	touchedNodes            []int  // nodes which received a gradient
+	isTouchedNode           []bool // indexed by node ID
+	regularization          node.Regularization
+	// quantized weights of each node, used instead of the node weights
+	// for inference if not nil (see Quantize)
+	quantized []quantization.Vector
 }
 
 type indexValuePairByValue []index_value.Pair
@@ -69,10 +79,12 @@ func New(
 	l int,
 	rangePow int,
 	sparsity float64,
-	weights []float64,
-	bias []float64,
-	adamAvgMom []float64,
-	adamAvgVel []float64,
+	opt optimizer.Optimizer,
+	regularization node.Regularization,
+	weights []mat.Float,
+	bias []mat.Float,
+	firstMoments []mat.Float,
+	secondMoments []mat.Float,
 ) *Layer {
 	// Create a list of random nodes just in case not enough nodes
 	// from hashtable for active nodes.
@@ -93,14 +105,18 @@ func New(
 		normalizationConstants:  nil,
 		k:                       k,
 		l:                       l,
+		rangePow:                rangePow,
 		previousLayerNumOfNodes: previousLayerNumOfNodes,
 		// TODO: Initialize Hash Tables and add the nodes.
-		hashTables: lsh.New(k, l, rangePow),
-		wtaHasher:  nil,
-		minHasher:  nil,
-		srp:        nil,
-		dwtaHasher: nil,
-		binIds:     nil,
+		hashTables:     lsh.New(k, l, rangePow),
+		wtaHasher:      nil,
+		minHasher:      nil,
+		srp:            nil,
+		dwtaHasher:     nil,
+		binIds:         nil,
+		touchedNodes:   make([]int, 0),
+		isTouchedNode:  make([]bool, numOfNodes),
+		regularization: regularization,
 	}
 
 	switch configuration.Global.HashFunction {
@@ -126,96 +142,76 @@ func New(
 	}
 
 	var (
-		curWeights    []float64
-		curBias       []float64
-		curAdamAvgMom []float64
-		curAdamAvgVel []float64
+		curWeights       []mat.Float
+		curBias          []mat.Float
+		curFirstMoments  []mat.Float
+		curSecondMoments []mat.Float
 	)
 
+	useFirstMoments, useSecondMoments := opt.Moments()
+
 	if configuration.Global.LoadWeight {
 		curWeights = weights
 		curBias = bias
-		if configuration.Global.UseAdam {
-			curAdamAvgMom = adamAvgMom
-			curAdamAvgVel = adamAvgVel
+		if useFirstMoments {
+			curFirstMoments = firstMoments
+		}
+		if useSecondMoments {
+			curSecondMoments = secondMoments
 		}
 	} else {
 		// TODO: check if normal dist is comparable to C++ implementation
-		curWeights = make([]float64, numOfNodes*previousLayerNumOfNodes)
+		curWeights = make([]mat.Float, numOfNodes*previousLayerNumOfNodes)
 		for i := range curWeights {
-			curWeights[i] = rand.NormFloat64()*normalDistributionStdDev +
-				normalDistributionMean
+			curWeights[i] = mat.Float(rand.NormFloat64()*normalDistributionStdDev +
+				normalDistributionMean)
 		}
 
-		curBias = make([]float64, numOfNodes)
+		curBias = make([]mat.Float, numOfNodes)
 		for i := range curBias {
-			curBias[i] = rand.NormFloat64()*normalDistributionStdDev +
-				normalDistributionMean
+			curBias[i] = mat.Float(rand.NormFloat64()*normalDistributionStdDev +
+				normalDistributionMean)
 		}
 
-		if configuration.Global.UseAdam {
-			size := numOfNodes * previousLayerNumOfNodes
-			curAdamAvgMom = make([]float64, size)
-			curAdamAvgVel = make([]float64, size)
+		size := numOfNodes * previousLayerNumOfNodes
+		if useFirstMoments {
+			curFirstMoments = make([]mat.Float, size)
+		}
+		if useSecondMoments {
+			curSecondMoments = make([]mat.Float, size)
 		}
 	}
 
 	startTime := time.Now()
 
-	trainArray := make([]*node.NodeTrain, numOfNodes*batchSize)
-	for i := range trainArray {
-		trainArray[i] = node.NewNodeTrain(cowId)
-	}
-
-	// create nodes for this layer
-
-	nodes := make([]*node.Node, numOfNodes)
-	for i := range nodes {
-		nodes[i] = node.NewEmptyNode(cowId)
-	}
+	newLayer.nodes = node.NewStorage(
+		nodeType,
+		numOfNodes,
+		previousLayerNumOfNodes,
+		batchSize,
+		curWeights,
+		curBias,
+		curFirstMoments,
+		curSecondMoments,
+	)
 
 	// TODO: parallel!
-	for i := range nodes {
-		var layerAdamAvgMom []float64 = nil
-		var layerAdamAvgVel []float64 = nil
-
-		firstIndex := previousLayerNumOfNodes * i
-		lastIndex := firstIndex + previousLayerNumOfNodes
-
-		if configuration.Global.UseAdam {
-			layerAdamAvgMom = curAdamAvgMom[firstIndex:lastIndex]
-			layerAdamAvgVel = curAdamAvgVel[firstIndex:lastIndex]
-		}
-
-		nodes[i] = nodes[i].Update(
-			cowId,
-			previousLayerNumOfNodes,
-			i,
-			layerId,
-			nodeType,
-			batchSize,
-			curWeights[firstIndex:lastIndex],
-			curBias[i],
-			layerAdamAvgMom,
-			layerAdamAvgVel,
-			trainArray[batchSize*i:batchSize*i+batchSize],
-		)
+	for i := 0; i < numOfNodes; i++ {
+		n := newLayer.nodes.Node(i)
 		newLayer.addToHashTable(
 			cowId,
-			nodes[i].Weights(),
+			n.Weights(),
 			// TODO: custom length? -> previousLayerNumOfNodes,
-			nodes[i].Bias(),
+			n.Bias(),
 			i)
 	}
 
-	newLayer.nodes = nodes
-
 	endTime := time.Now()
 	elapsedTime := endTime.Sub(startTime)
 	fmt.Printf("%d %v\n", numOfNodes, elapsedTime)
 
 	if nodeType == node.Softmax {
-		newLayer.normalizationConstants = make([]float64, batchSize)
+		newLayer.normalizationConstants = make([]mat.Float, batchSize)
 	}
 
 	return newLayer
@@ -254,18 +250,19 @@ func (l *Layer) UpdateRandomNodes() {
 	swapRandNode := func(i, j int) {
 		l.randNode[i], l.randNode[j] = l.randNode[j], l.randNode[i]
 	}
-	rand.Shuffle(len(l.nodes), swapRandNode)
+	rand.Shuffle(l.nodes.NumNodes(), swapRandNode)
 }
 
-func (l *Layer) GetNodeById(nodeId int) *node.Node {
-	return l.nodes[nodeId]
+func (l *Layer) GetNodeById(nodeId int) node.Node {
+	return l.nodes.Node(nodeId)
 }
 
-func (l *Layer) GetAllNodes() []*node.Node {
+// Nodes returns the storage of all the nodes of the layer.
+func (l *Layer) Nodes() *node.Storage {
 	return l.nodes
 }
 
-func (l *Layer) GetNomalizationConstant(inputId int) float64 {
+func (l *Layer) GetNomalizationConstant(inputId int) mat.Float {
 	if l.nodeType != node.Softmax {
 		panic("Call to GetNomalizationConstant for non-softmax layer")
 	}
@@ -284,20 +281,65 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 
 	currentLayerActiveNodes := activeNodesPerLayer[layerIndex]
 
+	nextLayerActiveNodes, in := l.selectActiveNodes(
+		&Scratch{}, currentLayerActiveNodes, label, sparsity)
+	activeNodesPerLayer[layerIndex+1] = nextLayerActiveNodes
+
+	var maxValue mat.Float = 0
+	if l.nodeType == node.Softmax {
+		l.normalizationConstants[inputId] = 0
+	}
+
+	l.nodes.ResetExample(inputId, len(nextLayerActiveNodes))
+
+	// find activation for all ACTIVE nodes in layer
+	for i, pair := range nextLayerActiveNodes {
+		value := l.nodes.Node(pair.Index).GetActivation(
+			currentLayerActiveNodes, inputId, i)
+		nextLayerActiveNodes[i].Value = value
+		if l.nodeType == node.Softmax && value > maxValue {
+			maxValue = value
+		}
+	}
+
+	if l.nodeType == node.Softmax {
+		for i, pair := range nextLayerActiveNodes {
+			realActivation := mat.Exp(pair.Value - maxValue)
+			nextLayerActiveNodes[i].Value = realActivation
+			l.nodes.Node(pair.Index).SetlastActivation(
+				inputId, i, realActivation)
+			l.normalizationConstants[inputId] += realActivation
+		}
+	}
+
+	return in, l
+}
+
+// selectActiveNodes returns the nodes to be activated by the given
+// input, including the label nodes when given, and the number of nodes
+// retrieved from the hash tables. The returned slice belongs to scratch.
+//
+// The layer is not changed, so that it can be called concurrently
+// with different scratches.
+func (l *Layer) selectActiveNodes(
+	scratch *Scratch,
+	input []index_value.Pair,
+	label []int,
+	sparsity float64,
+) ([]index_value.Pair, int) {
 	//LSH QueryLogic
 
 	// Query out all the candidate nodes
 	var length int
+	var active []index_value.Pair
 	in := 0
 
 	if sparsity == 1.0 {
-		length = len(l.nodes)
-		// assuming not intitialized
-		newActiveNodes := make([]index_value.Pair, length)
-		for i := range newActiveNodes {
-			newActiveNodes[i].Index = i
+		length = l.nodes.NumNodes()
+		active = scratch.pairs(length)
+		for i := range active {
+			active[i].Index = i
 		}
-		activeNodesPerLayer[layerIndex+1] = newActiveNodes
 	} else {
 		switch configuration.Global.LayerMode {
 		case configuration.LayerMode1:
@@ -305,17 +347,17 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 
 			switch configuration.Global.HashFunction {
 			case configuration.WtaHashFunction:
-				hashes = l.wtaHasher.GetHash(currentLayerActiveNodes)
+				hashes = l.wtaHasher.GetHash(input)
 
 			case configuration.DensifiedWtaHashFunction:
-				hashes = l.dwtaHasher.GetHash(currentLayerActiveNodes)
+				hashes = l.dwtaHasher.GetHash(input)
 
 			case configuration.DensifiedMinhashFunction:
 				hashes = l.minHasher.GetHashEasy(
-					l.binIds, currentLayerActiveNodes, topK)
+					l.binIds, input, topK)
 
 			case configuration.SparseRandomProjectionHashFunction:
-				hashes = l.srp.GetHashSparse(currentLayerActiveNodes)
+				hashes = l.srp.GetHashSparse(input)
 
 			default:
 				panic(fmt.Sprintf("Unexpected hash function %d.",
@@ -352,27 +394,27 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 			}
 
 			length = len(vect)
-			activeNodesPerLayer[layerIndex+1] = make([]index_value.Pair, length)
-			copy(activeNodesPerLayer[layerIndex+1], vect)
+			active = scratch.pairs(length)
+			copy(active, vect)
 			in = length
 		case configuration.LayerMode2:
 			if l.nodeType == node.Softmax {
-				length = int(math.Floor(float64(len(l.nodes)) * sparsity))
-				activeNodesPerLayer[layerIndex+1] = make([]index_value.Pair, length)
+				length = int(math.Floor(float64(l.nodes.NumNodes()) * sparsity))
+				active = scratch.pairs(length)
 
 				bs := make([]bool, mapLen) // bitset
 				tmpSize := 0
 				if l.nodeType == node.Softmax && len(label) > 0 {
 					for i, labelValue := range label {
-						activeNodesPerLayer[layerIndex+1][i].Index = labelValue
+						active[i].Index = labelValue
 						bs[labelValue] = true
 					}
 					tmpSize = len(label)
 				}
 				for tmpSize < length {
-					v := rand.Intn(len(l.nodes))
+					v := rand.Intn(l.nodes.NumNodes())
 					if !bs[v] {
-						activeNodesPerLayer[layerIndex+1][tmpSize].Index = v
+						active[tmpSize].Index = v
 						bs[v] = true
 						tmpSize++
 					}
@@ -380,14 +422,20 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 			}
 		case configuration.LayerMode3:
 			if l.nodeType == node.Softmax {
-				length = int(math.Floor(float64(len(l.nodes)) * sparsity))
-				activeNodesPerLayer[layerIndex+1] = make([]index_value.Pair, length)
+				length = int(math.Floor(float64(l.nodes.NumNodes()) * sparsity))
+				active = scratch.pairs(length)
 
 				sortW := make([]index_value.Pair, 0)
 				what := 0
-				for s, curNode := range l.nodes {
-					tmp := l.innerproduct(
-						currentLayerActiveNodes, curNode.Weights())
+				for s := 0; s < l.nodes.NumNodes(); s++ {
+					curNode := l.nodes.Node(s)
+					var tmp mat.Float
+					if l.quantized != nil {
+						tmp = l.quantized[s].Dot(input)
+					} else {
+						tmp = l.innerproduct(
+							input, curNode.Weights())
+					}
 					tmp += curNode.Bias()
 
 					if intSliceContains(label, s) {
@@ -406,8 +454,8 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 
 				sort.Sort(indexValuePairByValue(sortW))
 
-				for i, sw := range sortW {
-					activeNodesPerLayer[layerIndex+1][i].Index = sw.Index
+				for i, sw := range sortW[:length] {
+					active[i].Index = sw.Index
 					if intSliceContains(label, sw.Index) {
 						in = 1
 					}
@@ -420,17 +468,17 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 
 			switch configuration.Global.HashFunction {
 			case configuration.WtaHashFunction:
-				hashes = l.wtaHasher.GetHash(currentLayerActiveNodes)
+				hashes = l.wtaHasher.GetHash(input)
 
 			case configuration.DensifiedWtaHashFunction:
-				hashes = l.dwtaHasher.GetHash(currentLayerActiveNodes)
+				hashes = l.dwtaHasher.GetHash(input)
 
 			case configuration.DensifiedMinhashFunction:
 				hashes = l.minHasher.GetHashEasy(
-					l.binIds, currentLayerActiveNodes, topK)
+					l.binIds, input, topK)
 
 			case configuration.SparseRandomProjectionHashFunction:
-				hashes = l.srp.GetHashSparse(currentLayerActiveNodes)
+				hashes = l.srp.GetHashSparse(input)
 
 			default:
 				panic(fmt.Sprintf("Unexpected hash function %d.",
@@ -445,7 +493,7 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 			// Get candidates from hashtable
 
 			countsSize := 0
-			counts := make([]int, len(l.nodes))
+			counts := scratch.ints(l.nodes.NumNodes())
 			for i := range counts {
 				counts[i] = -1
 			}
@@ -472,8 +520,8 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 			in = countsSize
 
 			if countsSize < 1500 { // TODO: avoid magic number
-				start := rand.Intn(len(l.nodes))
-				for i := start; i < len(l.nodes); i++ {
+				start := rand.Intn(l.nodes.NumNodes())
+				for i := start; i < l.nodes.NumNodes(); i++ {
 					if countsSize >= 1000 { // TODO: avoid magic number
 						break
 					}
@@ -498,7 +546,7 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 			}
 
 			length = countsSize
-			newActiveNodes := make([]index_value.Pair, length)
+			newActiveNodes := scratch.pairs(length)
 
 			// copy map into new array
 			i := 0
@@ -508,46 +556,108 @@ func (la *Layer) QueryActiveNodeAndComputeActivations(
 					i++
 				}
 			}
-			activeNodesPerLayer[layerIndex+1] = newActiveNodes
+			active = newActiveNodes
 		}
 	}
 
-	// ***********************************
-
-	nextLayerActiveNodes := activeNodesPerLayer[layerIndex+1]
+	return active, in
+}
 
-	maxValue := 0.0
-	if l.nodeType == node.Softmax {
-		l.normalizationConstants[inputId] = 0
+// MarkNodeTouched records that the node received a gradient during
+// the current batch.
+func (l *Layer) MarkNodeTouched(nodeId int) {
+	if !l.isTouchedNode[nodeId] {
+		l.isTouchedNode[nodeId] = true
+		l.touchedNodes = append(l.touchedNodes, nodeId)
 	}
+}
 
-	nodes := l.nodes
+// ApplyGradients updates the nodes parameters with the gradients
+// accumulated during the current batch. With sparse updates, only the
+// nodes marked as touched are updated.
+func (la *Layer) ApplyGradients(
+	cowId int,
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	iter int,
+) *Layer {
+	l := la.cloneIfNeeded(cowId)
 
-	// find activation for all ACTIVE nodes in layer
-	for i, pair := range nextLayerActiveNodes {
-		var value float64
-		value, nodes[pair.Index] =
-			nodes[pair.Index].GetActivation(
-				cowId, currentLayerActiveNodes, inputId,
-			)
-		nextLayerActiveNodes[i].Value = value
-		if l.nodeType == node.Softmax && value > maxValue {
-			maxValue = value
+	if !configuration.Global.SparseUpdates {
+		// TODO: parallel!
+		for i := 0; i < l.nodes.NumNodes(); i++ {
+			l.nodes.Node(i).ApplyGradients(
+				opt, learningRate, iter+1, l.regularization)
 		}
+		return l
 	}
 
-	if l.nodeType == node.Softmax {
-		for i, pair := range nextLayerActiveNodes {
-			realActivation := math.Exp(pair.Value - maxValue)
-			nextLayerActiveNodes[i].Value = realActivation
-			nodes[pair.Index] = nodes[pair.Index].SetlastActivation(
-				cowId, inputId, realActivation,
-			)
-			l.normalizationConstants[inputId] += realActivation
+	// TODO: parallel!
+	for _, nodeId := range l.touchedNodes {
+		l.nodes.Node(nodeId).ApplySparseGradients(
+			opt, learningRate, iter, l.regularization)
+		l.isTouchedNode[nodeId] = false
+	}
+	l.touchedNodes = l.touchedNodes[:0]
+
+	return l
+}
+
+// Dropout randomly zeroes the activations of the given active nodes
+// with probability rate, and scales the others by 1 / (1 - rate).
+// The values of activeNodes are updated as well.
+//
+// Dropped nodes behave like inactive ReLU units during backpropagation,
+// so they receive no delta. The deltas of the kept nodes must be scaled
+// accordingly (see node.BackPropagate).
+func (la *Layer) Dropout(
+	cowId int,
+	activeNodes []index_value.Pair,
+	inputId int,
+	rate float64,
+) *Layer {
+	l := la.cloneIfNeeded(cowId)
+	scale := mat.Float(1 / (1 - rate))
+
+	for i, pair := range activeNodes {
+		if rand.Float64() < rate {
+			activeNodes[i].Value = 0
+		} else {
+			activeNodes[i].Value *= scale
 		}
+		l.nodes.Node(pair.Index).SetlastActivation(
+			inputId, i, activeNodes[i].Value)
 	}
 
-	return in, l
+	return l
+}
+
+// Quantize returns a copy of the layer for inference only, where
+// activations are computed from quantized weights, and the nodes are
+// added to new hash tables by hashing their quantized weights.
+//
+// The quantized layer keeps only the biases and the quantized weights,
+// and no reference to the full-precision weights and optimizer state
+// of the original layer, which can be released. It can be used only
+// with ComputeActivations.
+func (l *Layer) Quantize(quantize quantization.Quantizer) *Layer {
+	newLayer := &Layer{}
+	*newLayer = *l
+	newLayer.nodes = l.nodes.BiasOnly()
+	newLayer.touchedNodes = nil
+	newLayer.isTouchedNode = nil
+	newLayer.normalizationConstants = nil
+	newLayer.quantized = make([]quantization.Vector, l.nodes.NumNodes())
+	newLayer.hashTables = lsh.New(l.k, l.l, l.rangePow)
+
+	hashValues := make([]mat.Float, l.previousLayerNumOfNodes)
+	for i := range newLayer.quantized {
+		n := l.nodes.Node(i)
+		newLayer.quantized[i] = quantize(n.Weights())
+		newLayer.quantized[i].HashValues(hashValues)
+		newLayer.addToHashTable(l.cowId, hashValues, n.Bias(), i)
+	}
+	return newLayer
 }
 
 func (l *Layer) ClearHashTables() {
@@ -555,10 +665,10 @@ func (l *Layer) ClearHashTables() {
 }
 
 func (l *Layer) NumOfNodes() int {
-	return len(l.nodes)
+	return l.nodes.NumNodes()
 }
 
-func (l *Layer) GetHashForInputProcessing(weights []float64) []int {
+func (l *Layer) GetHashForInputProcessing(weights []mat.Float) []int {
 	// TODO: duplicated code
 	switch configuration.Global.HashFunction {
 	case configuration.WtaHashFunction:
@@ -589,8 +699,8 @@ func (l *Layer) HashTablesAdd(indices []int, id int) []int {
 
 func (l *Layer) addToHashTable(
 	cowId int,
-	weights []float64,
-	bias float64,
+	weights []mat.Float,
+	bias mat.Float,
 	id int,
 ) {
 	// LSH logic
@@ -620,9 +730,9 @@ func (l *Layer) addToHashTable(
 
 func (l *Layer) innerproduct(
 	activeNodesPerLayer []index_value.Pair,
-	weights []float64,
-) float64 {
-	total := 0.0
+	weights []mat.Float,
+) mat.Float {
+	var total mat.Float = 0
 	for _, pair := range activeNodesPerLayer {
 		total += pair.Value * weights[pair.Index]
 	}
@@ -0,0 +1,238 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package layer
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/quantization"
+)
+
+// updateCounter is an SGD optimizer which counts the updates of each
+// parameter.
+type updateCounter struct {
+	updates map[*mat.Float]int
+}
+
+func (o *updateCounter) Moments() (first, second bool) {
+	return false, false
+}
+
+func (o *updateCounter) Update(param *mat.Float, grad mat.Float, _, _ *mat.Float, lr mat.Float, _ int) {
+	o.updates[param]++
+	*param -= lr * grad
+}
+
+func TestApplyGradientsTouchedNodesOnly(t *testing.T) {
+	l := newTestLayer(t, true, 3, 2, false)
+	opt := &updateCounter{updates: make(map[*mat.Float]int)}
+
+	backPropagate(l, []int{1}, features(2, 2), 1)
+	l.ApplyGradients(0, opt, 0.5, 0)
+
+	for nodeId := 0; nodeId < 3; nodeId++ {
+		n := l.nodes.Node(nodeId)
+		expected, updates := mat.Float(1), 0
+		if nodeId == 1 {
+			expected, updates = 2, 1
+		}
+		for i := range n.Weights() {
+			assertFloatEqual(t, n.Weights()[i], expected, "weight")
+			assertIntEqual(t, opt.updates[&n.Weights()[i]], updates,
+				"weight updates")
+		}
+	}
+
+	assertIntEqual(t, len(l.touchedNodes), 0, "touched nodes")
+	for nodeId, touched := range l.isTouchedNode {
+		if touched {
+			t.Errorf("node %d is still marked as touched", nodeId)
+		}
+	}
+}
+
+func TestApplyGradientsDenseSparseEquivalence(t *testing.T) {
+	t.Run("SGD", func(t *testing.T) {
+		// with SGD, skipping the nodes without gradients does not
+		// change anything, even if not all nodes are touched
+		testDenseSparseEquivalence(t, optimizer.NewSGD(), false, [][]int{{0, 2}, {1}, {0, 1}})
+	})
+	t.Run("Adam", func(t *testing.T) {
+		// with Adam, the updates are the same as long as every weight
+		// is touched at every iteration
+		testDenseSparseEquivalence(t, optimizer.NewAdam(0.9, 0.999, 1e-8), true, [][]int{{0, 1, 2}, {0, 1, 2}, {0, 1, 2}})
+	})
+}
+
+func testDenseSparseEquivalence(t *testing.T, opt optimizer.Optimizer, moments bool, touched [][]int) {
+	dense := newTestLayer(t, false, 3, 2, moments)
+	sparse := newTestLayer(t, true, 3, 2, moments)
+
+	for iter, nodeIds := range touched {
+		delta := mat.Float(iter+1) / 4
+		setSparseUpdates(t, false)
+		backPropagate(dense, nodeIds, features(1, -2), delta)
+		dense.ApplyGradients(0, opt, 0.1, iter)
+		setSparseUpdates(t, true)
+		backPropagate(sparse, nodeIds, features(1, -2), delta)
+		sparse.ApplyGradients(0, opt, 0.1, iter)
+	}
+
+	for nodeId := 0; nodeId < 3; nodeId++ {
+		d := dense.nodes.Node(nodeId)
+		s := sparse.nodes.Node(nodeId)
+		for i := range d.Weights() {
+			assertFloatEqual(t, s.Weights()[i], d.Weights()[i], "weight")
+		}
+		assertFloatEqual(t, s.Bias(), d.Bias(), "bias")
+	}
+}
+
+func TestDropout(t *testing.T) {
+	rand.Seed(1)
+	l := newTestLayer(t, true, 100, 1, false)
+	l.nodes.ResetExample(0, 100)
+	activeNodes := make([]index_value.Pair, 100)
+	for i := range activeNodes {
+		activeNodes[i] = index_value.Pair{Index: i, Value: 2}
+	}
+
+	l.Dropout(0, activeNodes, 0, 0.5)
+
+	dropped := 0
+	for slot, pair := range activeNodes {
+		n := l.nodes.Node(pair.Index)
+		assertFloatEqual(t, n.GetLastActivation(0, slot), pair.Value,
+			"last activation")
+		n.IncrementDelta(0, slot, 1)
+		delta := -n.GetGradient(0, 0, slot, 1)
+
+		switch pair.Value {
+		case 0:
+			dropped++
+			assertFloatEqual(t, delta, 0, "delta of dropped node")
+		case 4:
+			assertFloatEqual(t, delta, 1, "delta of kept node")
+		default:
+			t.Errorf("unexpected activation %g after dropout", pair.Value)
+		}
+	}
+
+	if dropped == 0 || dropped == len(activeNodes) {
+		t.Errorf("%d of %d nodes dropped", dropped, len(activeNodes))
+	}
+}
+
+func TestQuantize(t *testing.T) {
+	setSparseUpdates(t, true)
+	rand.Seed(1)
+	l := New(0, 5, 3, 0, node.ReLU, 1, 2, 4, 6, 1, optimizer.NewSGD(),
+		node.Regularization{}, nil, nil, nil, nil)
+	for i := 0; i < l.NumOfNodes(); i++ {
+		for j := range l.nodes.Node(i).Weights() {
+			l.nodes.Node(i).Weights()[j] = mat.Float(rand.NormFloat64())
+		}
+	}
+
+	q := l.Quantize(quantization.NewBFloat16Vector)
+
+	for i := 0; i < q.NumOfNodes(); i++ {
+		assertIntEqual(t, len(q.nodes.Node(i).Weights()), 0,
+			"weights of quantized node")
+	}
+
+	input := features(1, -2, 0.5)
+	active := q.ComputeActivations(input, 1, &Scratch{})
+	assertIntEqual(t, len(active), l.NumOfNodes(), "active nodes")
+	for _, pair := range active {
+		n := l.nodes.Node(pair.Index)
+		expected := n.QuantizedActivation(
+			input, quantization.NewBFloat16Vector(n.Weights()))
+		assertFloatEqual(t, pair.Value, expected, "activation")
+		assertFloatEqual(t, q.nodes.Node(pair.Index).Bias(), n.Bias(), "bias")
+	}
+}
+
+// newTestLayer creates a layer of numNodes ReLU nodes with dim weights
+// each, all set to 1, and no hash tables.
+func newTestLayer(t *testing.T, sparse bool, numNodes, dim int, moments bool) *Layer {
+	setSparseUpdates(t, sparse)
+
+	weights := make([]mat.Float, numNodes*dim)
+	for i := range weights {
+		weights[i] = 1
+	}
+	bias := make([]mat.Float, numNodes)
+	for i := range bias {
+		bias[i] = 1
+	}
+
+	var firstMoments, secondMoments []mat.Float
+	if moments {
+		firstMoments = make([]mat.Float, numNodes*dim)
+		secondMoments = make([]mat.Float, numNodes*dim)
+	}
+	return &Layer{
+		nodeType: node.ReLU,
+		nodes: node.NewStorage(node.ReLU, numNodes, dim, 1, weights, bias,
+			firstMoments, secondMoments),
+		previousLayerNumOfNodes: dim,
+		isTouchedNode:           make([]bool, numNodes),
+	}
+}
+
+// backPropagate accumulates the gradients of the given nodes of a
+// first layer, as if each of them received the given delta for an
+// example with the given features.
+func backPropagate(l *Layer, nodeIds []int, features []index_value.Pair, delta mat.Float) {
+	l.nodes.ResetExample(0, len(nodeIds))
+	for slot, nodeId := range nodeIds {
+		n := l.nodes.Node(nodeId)
+		n.SetlastActivation(0, slot, 1)
+		n.IncrementDelta(0, slot, delta)
+		n.BackPropagateFirstLayer(features, 0, slot)
+		l.MarkNodeTouched(nodeId)
+	}
+}
+
+// features returns the dense features with the given values.
+func features(values ...mat.Float) []index_value.Pair {
+	pairs := make([]index_value.Pair, len(values))
+	for i, v := range values {
+		pairs[i] = index_value.Pair{Index: i, Value: v}
+	}
+	return pairs
+}
+
+// setSparseUpdates sets the global configuration for the duration of
+// the test.
+func setSparseUpdates(t *testing.T, sparse bool) {
+	previous := configuration.Global.SparseUpdates
+	configuration.Global.SparseUpdates = sparse
+	t.Cleanup(func() {
+		configuration.Global.SparseUpdates = previous
+	})
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual, expected mat.Float, msg string) {
+	if math.Abs(float64(actual-expected)) > 1e-5 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
@@ -0,0 +1,16 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build float32
+// +build float32
+
+package mat
+
+// Float is the floating-point type used for parameters, optimizer
+// state and activations. It is float32 when building with the
+// "float32" tag, or float64 otherwise.
+type Float = float32
+
+// BitSize is the size in bits of Float.
+const BitSize = 32
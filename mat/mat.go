@@ -0,0 +1,25 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Floating-point type selection and math helpers working on it.
+package mat
+
+import "math"
+
+func Sqrt(x Float) Float {
+	return Float(math.Sqrt(float64(x)))
+}
+
+func Exp(x Float) Float {
+	return Float(math.Exp(float64(x)))
+}
+
+func Pow(x, y Float) Float {
+	return Float(math.Pow(float64(x), float64(y)))
+}
+
+func IsFinite(x Float) bool {
+	f := float64(x)
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Ranking metrics for extreme multi-label classification, as reported
+// by The Extreme Classification Repository.
+package metrics
+
+import (
+	"math"
+	"sort"
+
+	"github.com/nlpodyssey/goslide/index_value"
+)
+
+// Result contains the metrics at a given rank K, averaged over
+// all the examples.
+type Result struct {
+	K int
+	// Precision is P@k.
+	Precision float64
+	// NDCG is nDCG@k.
+	NDCG float64
+	// PSPrecision is the propensity scored PSP@k, normalized by its
+	// maximum achievable value.
+	PSPrecision float64
+	// PSNDCG is the propensity scored PSnDCG@k, normalized by its
+	// maximum achievable value. As in The Extreme Classification
+	// Repository, the PSDCG@k of each example is first divided by its
+	// ideal DCG@k, over min(k, number of labels) positions.
+	PSNDCG float64
+}
+
+// Evaluator accumulates the metrics of ranked predictions.
+type Evaluator struct {
+	ks              []int
+	invPropensities []float64
+	numExamples     int
+	precision       []float64
+	ndcg            []float64
+	psPrecision     []float64
+	psNdcg          []float64
+	maxPsPrecision  []float64
+	maxPsNdcg       []float64
+	labelWeights    []float64 // reused buffer
+}
+
+// NewEvaluator creates an evaluator for the given ranks. The
+// propensity scored metrics are computed only if invPropensities,
+// indexed by label, is not nil.
+func NewEvaluator(ks []int, invPropensities []float64) *Evaluator {
+	return &Evaluator{
+		ks:              ks,
+		invPropensities: invPropensities,
+		precision:       make([]float64, len(ks)),
+		ndcg:            make([]float64, len(ks)),
+		psPrecision:     make([]float64, len(ks)),
+		psNdcg:          make([]float64, len(ks)),
+		maxPsPrecision:  make([]float64, len(ks)),
+		maxPsNdcg:       make([]float64, len(ks)),
+	}
+}
+
+// Add evaluates the predictions of an example, sorted by decreasing
+// score, against its true labels.
+func (e *Evaluator) Add(predictions []index_value.Pair, labels []int) {
+	e.numExamples++
+
+	for i, k := range e.ks {
+		var hits, dcg, psHits, psDcg float64
+		for rank := 0; rank < k && rank < len(predictions); rank++ {
+			label := predictions[rank].Index
+			if !intSliceContains(labels, label) {
+				continue
+			}
+			hits++
+			dcg += discount(rank)
+			if e.invPropensities != nil {
+				psHits += e.invPropensities[label]
+				psDcg += e.invPropensities[label] * discount(rank)
+			}
+		}
+		idcg := idealDcg(k, len(labels))
+
+		e.precision[i] += hits / float64(k)
+		e.ndcg[i] += ratio(dcg, idcg)
+		e.psPrecision[i] += psHits / float64(k)
+		e.psNdcg[i] += ratio(psDcg, idcg)
+	}
+
+	if e.invPropensities != nil {
+		e.addMaxPropensityScores(labels)
+	}
+}
+
+// addMaxPropensityScores accumulates the propensity scored metrics of
+// the ideal ranking, with the true labels sorted by decreasing inverse
+// propensity.
+func (e *Evaluator) addMaxPropensityScores(labels []int) {
+	weights := e.labelWeights[:0]
+	for _, label := range labels {
+		weights = append(weights, e.invPropensities[label])
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(weights)))
+	e.labelWeights = weights
+
+	for i, k := range e.ks {
+		var psHits, psDcg float64
+		for rank := 0; rank < k && rank < len(weights); rank++ {
+			psHits += weights[rank]
+			psDcg += weights[rank] * discount(rank)
+		}
+		e.maxPsPrecision[i] += psHits / float64(k)
+		e.maxPsNdcg[i] += ratio(psDcg, idealDcg(k, len(weights)))
+	}
+}
+
+// NumExamples returns the number of evaluated examples.
+func (e *Evaluator) NumExamples() int {
+	return e.numExamples
+}
+
+// Results returns the metrics for each rank.
+func (e *Evaluator) Results() []Result {
+	results := make([]Result, len(e.ks))
+	for i, k := range e.ks {
+		results[i] = Result{
+			K:           k,
+			Precision:   ratio(e.precision[i], float64(e.numExamples)),
+			NDCG:        ratio(e.ndcg[i], float64(e.numExamples)),
+			PSPrecision: ratio(e.psPrecision[i], e.maxPsPrecision[i]),
+			PSNDCG:      ratio(e.psNdcg[i], e.maxPsNdcg[i]),
+		}
+	}
+	return results
+}
+
+// discount returns the DCG discount of the given 0-based rank.
+func discount(rank int) float64 {
+	return 1 / math.Log2(float64(rank)+2)
+}
+
+// idealDcg returns the DCG@k of a ranking with all the true labels first.
+func idealDcg(k, numLabels int) float64 {
+	var dcg float64
+	for rank := 0; rank < k && rank < numLabels; rank++ {
+		dcg += discount(rank)
+	}
+	return dcg
+}
+
+func ratio(a, b float64) float64 {
+	if b == 0 {
+		return 0
+	}
+	return a / b
+}
+
+func intSliceContains(slice []int, value int) bool {
+	for _, v := range slice {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
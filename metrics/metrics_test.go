@@ -0,0 +1,97 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+func TestInversePropensities(t *testing.T) {
+	inv := InversePropensities([]int{0, 10, 1000}, 10000,
+		DefaultPropensityA, DefaultPropensityB)
+
+	c := (math.Log(10000) - 1) * math.Pow(2.5, 0.55)
+	assertFloatEqual(t, inv[0], 1+c*math.Pow(1.5, -0.55), "unseen label")
+	assertFloatEqual(t, inv[1], 1+c*math.Pow(11.5, -0.55), "rare label")
+
+	if !(inv[0] > inv[1] && inv[1] > inv[2] && inv[2] > 1) {
+		t.Errorf("Assertion failed: decreasing with frequency | actual %v", inv)
+	}
+}
+
+func TestEvaluator(t *testing.T) {
+	e := NewEvaluator([]int{1, 3}, nil)
+	e.Add(predictions(2, 1, 0), []int{0, 2})
+	e.Add(predictions(1), []int{1})
+
+	results := e.Results()
+	assertIntEqual(t, e.NumExamples(), 2, "NumExamples")
+	assertIntEqual(t, results[0].K, 1, "K")
+	assertIntEqual(t, results[1].K, 3, "K")
+
+	assertFloatEqual(t, results[0].Precision, 1, "P@1")
+	assertFloatEqual(t, results[0].NDCG, 1, "nDCG@1")
+
+	// the second example has a single prediction, and a single label
+	assertFloatEqual(t, results[1].Precision, (2.0/3+1.0/3)/2, "P@3")
+	ndcg := (1 + 1/math.Log2(4)) / (1 + 1/math.Log2(3))
+	assertFloatEqual(t, results[1].NDCG, (ndcg+1)/2, "nDCG@3")
+}
+
+func TestEvaluatorPropensityScored(t *testing.T) {
+	e := NewEvaluator([]int{1, 3}, []float64{1, 1, 3})
+	e.Add(predictions(1, 0, 2), []int{0, 2})
+
+	results := e.Results()
+	assertFloatEqual(t, results[0].PSPrecision, 0, "PSP@1")
+	assertFloatEqual(t, results[0].PSNDCG, 0, "PSnDCG@1")
+	assertFloatEqual(t, results[1].PSPrecision, 1, "PSP@3")
+	assertFloatEqual(t, results[1].PSNDCG,
+		(1/math.Log2(3)+3/math.Log2(4))/(3+1/math.Log2(3)), "PSnDCG@3")
+}
+
+func TestEvaluatorPropensityScoredNormalization(t *testing.T) {
+	// the PSDCG of each example is normalized by its own ideal DCG,
+	// so examples with more labels do not weigh more
+	e := NewEvaluator([]int{1, 3}, []float64{1, 2, 4, 8})
+	e.Add(predictions(3, 1, 0), []int{0, 3})
+	e.Add(predictions(0, 1, 2), []int{1})
+
+	results := e.Results()
+	assertFloatEqual(t, results[0].PSNDCG, 0.8, "PSnDCG@1")
+	assertFloatEqual(t, results[1].PSNDCG, 0.8877651813694207, "PSnDCG@3")
+}
+
+func TestEvaluatorEmpty(t *testing.T) {
+	results := NewEvaluator([]int{1}, []float64{1}).Results()
+	assertFloatEqual(t, results[0].Precision, 0, "P@1")
+	assertFloatEqual(t, results[0].PSNDCG, 0, "PSnDCG@1")
+}
+
+func predictions(labels ...int) []index_value.Pair {
+	pairs := make([]index_value.Pair, len(labels))
+	for i, label := range labels {
+		pairs[i] = index_value.Pair{Index: label, Value: 1 / mat.Float(i+1)}
+	}
+	return pairs
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual, expected float64, msg string) {
+	if math.Abs(actual-expected) > 1e-9 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import "math"
+
+// Common values of the propensity model parameters A and B.
+const (
+	DefaultPropensityA = 0.55
+	DefaultPropensityB = 1.5
+)
+
+// InversePropensities returns the inverse propensity of each label,
+// estimated from the number of training examples and the number of
+// training examples tagged with each label.
+//
+// Model from the paper:
+//   Extreme Multi-label Loss Functions for Recommendation, Tagging,
+//   Ranking & Other Missing Label Applications
+//   Himanshu Jain, Yashoteja Prabhu, Manik Varma
+//   https://doi.org/10.1145/2939672.2939756
+func InversePropensities(labelCounts []int, numExamples int, a, b float64) []float64 {
+	c := (math.Log(float64(numExamples)) - 1) * math.Pow(b+1, a)
+	inv := make([]float64, len(labelCounts))
+	for i, count := range labelCounts {
+		inv[i] = 1 + c*math.Exp(-a*math.Log(float64(count)+b))
+	}
+	return inv
+}
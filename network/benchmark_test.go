@@ -0,0 +1,94 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"math/rand"
+	"runtime"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/schedule"
+)
+
+const (
+	benchInputDim    = 5000
+	benchNumFeatures = 50
+	benchNumLabels   = 20000
+	benchBatchSize   = 32
+)
+
+// BenchmarkProcessInput trains a network with a large sparse output
+// layer and Adam. Besides the time per batch, it reports the memory
+// allocated by the network, to compare the float64 and float32 builds:
+//
+//	go test -run NONE -bench ProcessInput ./network
+//	go test -run NONE -bench ProcessInput -tags float32 ./network
+func BenchmarkProcessInput(b *testing.B) {
+	previous := configuration.Global
+	configuration.Global = configuration.Default()
+	defer func() {
+		configuration.Global = previous
+	}()
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	n := New(
+		0,
+		2,
+		[]int{128, benchNumLabels},
+		[]node.NodeType{node.ReLU, node.Softmax},
+		benchBatchSize,
+		schedule.NewConstant(0.0001),
+		optimizer.NewAdam(0.9, 0.999, 1e-8),
+		benchInputDim,
+		[]int{2, 4},
+		[]int{5, 10},
+		[]int{6, 12},
+		[]float64{1, 0.05, 1, 0.05},
+	)
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+
+	rng := rand.New(rand.NewSource(1))
+	batches := make([][]dataset.Example, 16)
+	for i := range batches {
+		batches[i] = benchExamples(rng)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		n.ProcessInput(0, batches[i%len(batches)], i, false, false)
+	}
+	b.StopTimer()
+	b.ReportMetric(float64(after.HeapAlloc-before.HeapAlloc)/(1<<20), "network-MiB")
+}
+
+// benchExamples returns a batch of examples with sparse features and a
+// few labels.
+func benchExamples(rng *rand.Rand) []dataset.Example {
+	examples := make([]dataset.Example, benchBatchSize)
+	for i := range examples {
+		features := make([]index_value.Pair, benchNumFeatures)
+		for j, index := range rng.Perm(benchInputDim)[:benchNumFeatures] {
+			features[j] = index_value.Pair{
+				Index: index,
+				Value: mat.Float(rng.Float64()),
+			}
+		}
+		labels := make([]int, 1+rng.Intn(3))
+		for j := range labels {
+			labels[j] = rng.Intn(benchNumLabels)
+		}
+		examples[i] = dataset.Example{Features: features, Labels: labels}
+	}
+	return examples
+}
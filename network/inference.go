@@ -0,0 +1,67 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/layer"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// Scratch is caller-owned memory for the inference of a single example,
+// which can be reused across calls, but not shared by concurrent ones.
+// Its zero value is ready to use.
+type Scratch struct {
+	layers []layer.Scratch
+}
+
+// Predict returns the predicted class of a single example, or -1 if no
+// output node is active.
+//
+// The network is not changed, and Predict can be called concurrently
+// from many goroutines, each one with its own scratch, as long as the
+// network is not being trained.
+func (n *Network) Predict(
+	features []index_value.Pair,
+	scratch *Scratch,
+) int {
+	predictClass := -1
+	var maxScore mat.Float
+	outputSparsity := n.sparsity[2*n.numberOfLayers-1]
+	for _, pair := range n.forward(features, outputSparsity, scratch) {
+		if predictClass == -1 || pair.Value > maxScore {
+			maxScore = pair.Value
+			predictClass = pair.Index
+		}
+	}
+	return predictClass
+}
+
+// forward returns the active nodes of the output layer for a single
+// example, with their softmax probabilities as values. The returned
+// slice belongs to scratch.
+//
+// The inference sparsity of the hidden layers is used, while the output
+// layer one is given.
+func (n *Network) forward(
+	features []index_value.Pair,
+	outputSparsity float64,
+	scratch *Scratch,
+) []index_value.Pair {
+	if len(scratch.layers) != n.numberOfLayers {
+		scratch.layers = make([]layer.Scratch, n.numberOfLayers)
+	}
+
+	activeNodes := features
+	for layerIndex, l := range n.hiddenLayers {
+		sparsity := n.sparsity[n.numberOfLayers+layerIndex]
+		if layerIndex == n.numberOfLayers-1 {
+			sparsity = outputSparsity
+		}
+		activeNodes = l.ComputeActivations(
+			activeNodes, sparsity, &scratch.layers[layerIndex])
+	}
+	return activeNodes
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/optimizer"
+)
+
+func TestConcurrentPredict(t *testing.T) {
+	useDefaultConfiguration(t)
+	n := newTestNetwork(t, 4, optimizer.NewSGD())
+	examples := testExamples(16)
+	for i := 0; i < len(examples); i += 4 {
+		n.ProcessInput(0, examples[i:i+4], i/4, false, false)
+	}
+	// retrieve the nodes from the hash tables at inference
+	n.sparsity = []float64{1, 1, 0.5, 0.5}
+
+	expectedClasses := make([]int, len(examples))
+	expectedTopK := make([][]index_value.Pair, len(examples))
+	for i, example := range examples {
+		expectedClasses[i] = n.Predict(example.Features, &Scratch{})
+		expectedTopK[i] = n.PredictTopK(example.Features, 2, false, &Scratch{})
+	}
+
+	pool := sync.Pool{New: func() interface{} { return &Scratch{} }}
+	classes := make([][]int, 8)
+	topK := make([][][]index_value.Pair, 8)
+	var wg sync.WaitGroup
+	for g := range classes {
+		classes[g] = make([]int, len(examples))
+		topK[g] = make([][]index_value.Pair, len(examples))
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i, example := range examples {
+				scratch := pool.Get().(*Scratch)
+				classes[g][i] = n.Predict(example.Features, scratch)
+				topK[g][i] = n.PredictTopK(example.Features, 2, false, scratch)
+				pool.Put(scratch)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	for g := range classes {
+		for i := range examples {
+			if classes[g][i] != expectedClasses[i] {
+				t.Errorf("Assertion failed: predicted class | expected %d, actual %d",
+					expectedClasses[i], classes[g][i])
+			}
+			assertPairsEqual(t, topK[g][i], expectedTopK[i], "top k")
+		}
+	}
+}
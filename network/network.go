@@ -7,27 +7,37 @@ package network
 import (
 	"fmt"
 	"math"
+	"math/rand"
 	"time"
 
 	"github.com/nlpodyssey/goslide/configuration"
 	"github.com/nlpodyssey/goslide/dataset"
 	"github.com/nlpodyssey/goslide/index_value"
 	"github.com/nlpodyssey/goslide/layer"
+	"github.com/nlpodyssey/goslide/mat"
 	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/quantization"
+	"github.com/nlpodyssey/goslide/schedule"
 )
 
-const (
-	beta1 = 0.9
-	beta2 = 0.999
-	eps   = 0.00000001
-)
+// Number of iterations after which the lists of random nodes
+// are shuffled again.
+const randomNodesUpdateInterval = 6946
 
 type Network struct {
 	cowId          int // "thread" ID for copy on write
 	hiddenLayers   []*layer.Layer
-	learningRate   float64
+	batchSize      int // maximum number of examples of a batch
+	learningRate   schedule.Schedule
+	optimizer      optimizer.Optimizer
 	numberOfLayers int
 	sparsity       []float64
+	dropout        []float64 // dropout rate of each hidden layer
+	inputDropout   float64   // dropout rate of the input features
+	// multiplies the scheduled learning rate, decreased on NaN values
+	learningRateFactor float64
+	checkpoint         []*layer.Checkpoint
 }
 
 func New(
@@ -36,7 +46,8 @@ func New(
 	sizesOfLayers []int,
 	layerTypes []node.NodeType,
 	batchSize int,
-	learningRate float64,
+	learningRate schedule.Schedule,
+	opt optimizer.Optimizer,
 	inputDim int,
 	k []int,
 	l []int,
@@ -48,10 +59,10 @@ func New(
 
 	for i := range hiddenLayers {
 		var (
-			weight     []float64 = nil
-			bias       []float64 = nil
-			adamAvgMom []float64 = nil
-			adamAvgVel []float64 = nil
+			weight        []mat.Float = nil
+			bias          []mat.Float = nil
+			firstMoments  []mat.Float = nil
+			secondMoments []mat.Float = nil
 		)
 
 		if configuration.Global.LoadWeight {
@@ -63,9 +74,9 @@ func New(
 				bias = biasArr.data<float>();
 
 				adamArr = arr["am_layer_"+to_string(i)];
-				adamAvgMom = adamArr.data<float>();
+				firstMoments = adamArr.data<float>();
 				adamvArr = arr["av_layer_"+to_string(i)];
-				adamAvgVel = adamvArr.data<float>();
+				secondMoments = adamvArr.data<float>();
 			*/
 		}
 
@@ -80,10 +91,12 @@ func New(
 			l[i],
 			rangePow[i],
 			sparsity[i],
+			opt,
+			layerRegularization(i),
 			weight,
 			bias,
-			adamAvgMom,
-			adamAvgVel,
+			firstMoments,
+			secondMoments,
 		)
 
 		previousLayerNumOfNodes = sizesOfLayers[i]
@@ -92,53 +105,38 @@ func New(
 	return &Network{
 		cowId:          cowId,
 		hiddenLayers:   hiddenLayers,
+		batchSize:      batchSize,
 		learningRate:   learningRate,
+		optimizer:      opt,
 		numberOfLayers: numOfLayers,
 		sparsity:       sparsity,
+		dropout:        configuration.Global.Dropout,
+		inputDropout:   configuration.Global.InputDropout,
+
+		learningRateFactor: 1,
+		checkpoint:         nil,
 	}
 }
 
+func (n *Network) LearningRate(iter int) float64 {
+	return n.learningRate.LearningRate(iter) * n.learningRateFactor
+}
+
+// PredictClass returns the number of examples whose predicted class is
+// one of their labels.
 func (ne *Network) PredictClass(
 	cowId int,
 	examples []dataset.Example,
 ) (int, *Network) {
 	n := ne.cloneIfNeeded(cowId)
 
-	hiddenLayers := n.hiddenLayers
-	lastHiddenLayer := hiddenLayers[n.numberOfLayers-1]
-
 	startTime := time.Now()
 	correctPred := 0
+	scratch := &Scratch{}
 
 	// TODO: parallel!
-	for i, example := range examples {
-		activeNodesPerLayer := make([][]index_value.Pair, n.numberOfLayers+1)
-		activeNodesPerLayer[0] = example.Features
-
-		//inference
-		for layerIndex, layer := range hiddenLayers {
-			_, hiddenLayers[layerIndex] =
-				layer.QueryActiveNodeAndComputeActivations(
-					cowId,
-					activeNodesPerLayer,
-					layerIndex,
-					i,
-					[]int{},
-					n.sparsity[n.numberOfLayers+layerIndex],
-				)
-		}
-
-		//compute softmax
-		var maxAct float64
-		var predictClass int
-		for pairIndex, pair := range activeNodesPerLayer[n.numberOfLayers] {
-			act := lastHiddenLayer.GetNodeById(pair.Index).GetLastActivation(i)
-			if maxAct < act || pairIndex == 0 {
-				maxAct = act
-				predictClass = pair.Index
-			}
-		}
-
+	for _, example := range examples {
+		predictClass := n.Predict(example.Features, scratch)
 		if intSliceContains(example.Labels, predictClass) {
 			correctPred++
 		}
@@ -150,6 +148,9 @@ func (ne *Network) PredictClass(
 	return correctPred, n
 }
 
+// ProcessInput trains the network on a batch of examples, which can be
+// at most as many as the batch size given to New. The gradients are
+// averaged over the actual number of examples.
 func (ne *Network) ProcessInput(
 	cowId int,
 	examples []dataset.Example,
@@ -158,6 +159,7 @@ func (ne *Network) ProcessInput(
 	rebuild bool,
 ) (float64, *Network) {
 	n := ne.cloneIfNeeded(cowId)
+	n.checkBatchLength(len(examples))
 
 	hiddenLayers := n.hiddenLayers
 
@@ -165,27 +167,28 @@ func (ne *Network) ProcessInput(
 	avgRetrieval := make([]int, n.numberOfLayers)
 	// avgRetrieval contains all zeroes by default
 
-	if iter%6946 == 6945 { // TODO: avoid magic number
-		// TODO: ?? _learningRate *= 0.5;
-
+	if iter%randomNodesUpdateInterval == randomNodesUpdateInterval-1 {
 		for i := 1; i < n.numberOfLayers; i++ {
 			// FIXME: or should this be done only on the very last layer?
 			hiddenLayers[i].UpdateRandomNodes()
 		}
 	}
 
-	tmpLr := n.learningRate
-	if configuration.Global.UseAdam {
-		tmpLr = n.learningRate *
-			math.Sqrt(1-math.Pow(beta2, float64(iter)+1.0)) /
-			(1.0 - math.Pow(beta1, float64(iter)+1.0))
-		// TODO: ?? else: tmplr *= pow(0.9, iter/10.0);
+	nanPolicy := configuration.Global.NanPolicy
+	checkFinite := nanPolicy != configuration.IgnoreNan
+	finite := true
+
+	if nanPolicy == configuration.RollbackOnNan &&
+		iter%configuration.Global.CheckpointInterval == 0 {
+		n.saveCheckpoint()
 	}
 
 	// TODO: parallel!
 	for i, example := range examples {
+		features := dropFeatures(example.Features, n.inputDropout)
+
 		activeNodesPerLayer := make([][]index_value.Pair, n.numberOfLayers+1)
-		activeNodesPerLayer[0] = example.Features
+		activeNodesPerLayer[0] = features
 
 		for layerIndex, layer := range hiddenLayers {
 			var in int
@@ -199,6 +202,16 @@ func (ne *Network) ProcessInput(
 					n.sparsity[layerIndex],
 				)
 			avgRetrieval[layerIndex] += in
+
+			if checkFinite && !hiddenLayers[layerIndex].ActivationsAreFinite(
+				activeNodesPerLayer[layerIndex+1], i) {
+				finite = false
+			}
+
+			if rate := n.layerDropout(layerIndex); rate > 0 {
+				hiddenLayers[layerIndex] = hiddenLayers[layerIndex].Dropout(
+					cowId, activeNodesPerLayer[layerIndex+1], i, rate)
+			}
 		}
 
 		// Backpropagation
@@ -208,42 +221,44 @@ func (ne *Network) ProcessInput(
 			nextLayerActiveNodes := activeNodesPerLayer[layerIndex+1]
 
 			// nodes
-			for _, pair := range nextLayerActiveNodes {
+			for slot, pair := range nextLayerActiveNodes {
+				layer.MarkNodeTouched(pair.Index)
 				node := layer.GetNodeById(pair.Index)
 				if layerIndex == n.numberOfLayers-1 {
 					//TODO: Compute Extra stats: labels[i];
-					// FIXME: we should reassign the cow-ed node into the layer
 					node.ComputeExtaStatsForSoftMax(
-						cowId,
 						layer.GetNomalizationConstant(i),
 						i,
+						slot,
 						example.Labels,
+						len(examples),
 					)
 				}
 				if layerIndex != 0 {
-					prevLayer := hiddenLayers[layerIndex-1]
-					// FIXME: we should reassign the cow-ed node into the layer
-					allNodes := prevLayer.GetAllNodes()
 					node.BackPropagate(
-						cowId,
-						&allNodes, // FIXME: problematic...
+						hiddenLayers[layerIndex-1].Nodes(),
 						curLayerActiveNodes,
-						tmpLr,
+						dropoutScale(n.layerDropout(layerIndex-1)),
 						i,
+						slot,
 					)
 				} else {
-					// FIXME: we should reassign the cow-ed node into the layer
 					node.BackPropagateFirstLayer(
-						cowId,
-						example.Features,
-						tmpLr,
+						features,
 						i,
+						slot,
 					)
 				}
 			}
 		}
 	}
 
+	if finite {
+		n.applyGradients(cowId, iter, checkFinite)
+	} else {
+		n.recoverFromNan(cowId, iter, "activations")
+	}
+
 	for layerIndex, layer := range hiddenLayers {
 		curLayerSparsity := n.sparsity[layerIndex]
 		tmpRehash := rehash && curLayerSparsity < 1.0
@@ -255,51 +270,18 @@ func (ne *Network) ProcessInput(
 
 		if tmpRebuild {
 			hiddenLayers[layerIndex] = layer.UpdateTable(cowId)
+			layer = hiddenLayers[layerIndex]
 		}
 
-		const ratio = 1
-
-		// TODO: parallel!
-		for m := 0; m < layer.NumOfNodes(); m++ {
-			tmp := layer.GetNodeById(m)
-			curWeights := tmp.Weights()
-
-			if configuration.Global.UseAdam {
-				dim := tmp.AdamTDim()
-				for d := 0; d < dim; d++ {
-					t := tmp.GetT(d)
-					mom := tmp.GetAdamAvgMom(d)
-					vel := tmp.GetAdamAvgVel(d)
-
-					mom = beta1*mom + (1-beta1)*t
-					vel = beta2*vel + (1-beta2)*t*t
-
-					// Direclty modify the weight (by reference)
-					curWeights[d] += ratio * tmpLr * mom / (math.Sqrt(vel) + eps)
-					tmp = tmp.SetAdamAvgMom(cowId, d, mom)
-					tmp = tmp.SetAdamAvgVel(cowId, d, vel)
-					tmp = tmp.SetT(cowId, d, 0)
-				}
-
-				tmp = tmp.SetAdamAvgMomBias(cowId,
-					beta1*tmp.GetAdamAvgMomBias()+(1-beta1)*tmp.GetTBias())
-				tmp = tmp.SetAdamAvgVelBias(cowId,
-					beta2*tmp.GetAdamAvgVelBias()+(1-beta2)*tmp.GetTBias()*tmp.GetTBias())
-				tmp = tmp.SetBias(cowId,
-					tmp.GetBias()+ratio*tmpLr*tmp.GetAdamAvgMomBias()/(math.Sqrt(tmp.GetAdamAvgVelBias())+eps))
-				tmp = tmp.SetTBias(cowId, 0)
-			} else {
-				tmp = tmp.CopyWeightsAndBiasFromMirror(cowId)
-			}
-
-			// FIXME: now tmp was modified and should be set back into hiddenLayers[l]
-			if tmpRehash {
+		if tmpRehash {
+			// TODO: parallel!
+			for m := 0; m < layer.NumOfNodes(); m++ {
+				curWeights := layer.GetNodeById(m).Weights()
 				hashes := layer.GetHashForInputProcessing(curWeights)
 				hashIndices := layer.HashesToIndex(hashes)
 				layer.HashTablesAdd(hashIndices, m)
 			}
 		}
-
 	}
 
 	if rehash {
@@ -313,6 +295,165 @@ func (ne *Network) ProcessInput(
 	return logLoss, n
 }
 
+func (n *Network) checkBatchLength(length int) {
+	if length > n.batchSize {
+		panic(fmt.Sprintf("Batch of %d examples exceeds the batch size %d.",
+			length, n.batchSize))
+	}
+}
+
+// layerDropout returns the dropout rate of a hidden layer. Dropout is
+// never applied to the output layer.
+func (n *Network) layerDropout(layerIndex int) float64 {
+	if layerIndex >= len(n.dropout) || layerIndex == n.numberOfLayers-1 {
+		return 0
+	}
+	return n.dropout[layerIndex]
+}
+
+// dropFeatures returns a copy of the features where each one is
+// randomly removed with probability rate, and the remaining values
+// are scaled by 1 / (1 - rate).
+func dropFeatures(features []index_value.Pair, rate float64) []index_value.Pair {
+	if rate <= 0 {
+		return features
+	}
+
+	scale := dropoutScale(rate)
+	kept := make([]index_value.Pair, 0, len(features))
+	for _, pair := range features {
+		if rand.Float64() >= rate {
+			kept = append(kept, index_value.Pair{
+				Index: pair.Index,
+				Value: pair.Value * scale,
+			})
+		}
+	}
+	return kept
+}
+
+// dropoutScale returns the factor applied to the units kept by
+// inverted dropout, so that no rescaling is needed at inference time.
+func dropoutScale(rate float64) mat.Float {
+	return mat.Float(1 / (1 - rate))
+}
+
+func layerRegularization(layerIndex int) node.Regularization {
+	config := configuration.Global
+	reg := node.Regularization{}
+	if layerIndex < len(config.L2Regularization) {
+		reg.L2 = mat.Float(config.L2Regularization[layerIndex])
+	}
+	if layerIndex < len(config.MaxNorm) {
+		reg.MaxNorm = mat.Float(config.MaxNorm[layerIndex])
+	}
+	return reg
+}
+
+// applyGradients clips the gradients accumulated during the current
+// batch, if required, and updates the parameters of all layers.
+//
+// With checkFinite, the updates are checked for NaN and infinite values
+// before being applied; if any is found, no parameter is changed, and
+// the network recovers according to the NaN policy. It returns false
+// in that case.
+func (n *Network) applyGradients(cowId int, iter int, checkFinite bool) bool {
+	config := configuration.Global
+	hiddenLayers := n.hiddenLayers
+
+	switch config.GradientClipping {
+	case configuration.NodeGradientClipping:
+		for i, layer := range hiddenLayers {
+			hiddenLayers[i] = layer.ClipGradients(
+				cowId, mat.Float(config.MaxGradientNorm))
+		}
+	case configuration.GlobalGradientClipping:
+		sqNorm := 0.0
+		for _, layer := range hiddenLayers {
+			sqNorm += float64(layer.GradientSquaredNorm())
+		}
+		if norm := math.Sqrt(sqNorm); norm > config.MaxGradientNorm {
+			for i, layer := range hiddenLayers {
+				hiddenLayers[i] = layer.ScaleGradients(
+					cowId, mat.Float(config.MaxGradientNorm/norm))
+			}
+		}
+	}
+
+	learningRate := mat.Float(n.LearningRate(iter))
+
+	if checkFinite {
+		for _, layer := range hiddenLayers {
+			if !layer.UpdatesAreFinite(n.optimizer, learningRate, iter) {
+				n.recoverFromNan(cowId, iter, "updates")
+				return false
+			}
+		}
+	}
+
+	for i, layer := range hiddenLayers {
+		hiddenLayers[i] = layer.ApplyGradients(
+			cowId, n.optimizer, learningRate, iter)
+	}
+
+	return true
+}
+
+// recoverFromNan discards the gradients accumulated during the current
+// batch, and reacts to NaN or infinite values according to the
+// NaN policy.
+func (n *Network) recoverFromNan(cowId int, iter int, where string) {
+	config := configuration.Global
+	hiddenLayers := n.hiddenLayers
+
+	for i, layer := range hiddenLayers {
+		hiddenLayers[i] = layer.DiscardGradients(cowId)
+	}
+
+	switch config.NanPolicy {
+	case configuration.SkipBatchOnNan:
+		fmt.Printf("Non-finite %s at iteration %d: batch skipped\n",
+			where, iter)
+	case configuration.ReduceLearningRateOnNan:
+		n.learningRateFactor *= config.NanDecayRate
+		fmt.Printf("Non-finite %s at iteration %d: batch skipped, "+
+			"learning rate reduced to %g\n",
+			where, iter, n.LearningRate(iter))
+	case configuration.RollbackOnNan:
+		for i, layer := range hiddenLayers {
+			hiddenLayers[i] = layer.Restore(cowId, n.checkpoint[i])
+		}
+		fmt.Printf("Non-finite %s at iteration %d: rolled back to "+
+			"the last checkpoint\n", where, iter)
+	default:
+		panic(fmt.Sprintf("Unexpected NaN policy %d.", config.NanPolicy))
+	}
+}
+
+// saveCheckpoint copies the parameters and optimizer state of all
+// layers into the checkpoint, allocated only the first time.
+func (n *Network) saveCheckpoint() {
+	if n.checkpoint == nil {
+		n.checkpoint = make([]*layer.Checkpoint, len(n.hiddenLayers))
+	}
+	for i, layer := range n.hiddenLayers {
+		n.checkpoint[i] = layer.SaveCheckpoint(n.checkpoint[i])
+	}
+}
+
+// Quantize returns a copy of the network for inference only, where all
+// layers use quantized weights (see layer.Quantize).
+func (n *Network) Quantize(quantize quantization.Quantizer) *Network {
+	newNetwork := &Network{}
+	*newNetwork = *n
+	newNetwork.hiddenLayers = make([]*layer.Layer, len(n.hiddenLayers))
+	for i, l := range n.hiddenLayers {
+		newNetwork.hiddenLayers[i] = l.Quantize(quantize)
+	}
+	newNetwork.checkpoint = nil
+	return newNetwork
+}
+
 func (n *Network) cloneIfNeeded(cowId int) *Network {
 	if n.cowId != cowId {
 		return n.clone(cowId)
@@ -0,0 +1,285 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/node"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/schedule"
+)
+
+const (
+	testInputDim   = 6
+	testNumClasses = 4
+)
+
+func TestDropoutDisabledAtInference(t *testing.T) {
+	config := useDefaultConfiguration(t)
+	config.Dropout = []float64{0.5}
+	config.InputDropout = 0.5
+	n := newTestNetwork(t, 4, optimizer.NewSGD())
+
+	examples := testExamples(4)
+	n.ProcessInput(0, examples, 0, false, false)
+
+	expected := make([][]index_value.Pair, len(examples))
+	for i, example := range examples {
+		expected[i] = n.PredictTopK(example.Features, testNumClasses, true, &Scratch{})
+	}
+
+	// inference is deterministic, and gives the same scores as the
+	// network without dropout
+	withoutDropout := *n
+	withoutDropout.dropout = nil
+	withoutDropout.inputDropout = 0
+	for i, example := range examples {
+		for _, network := range []*Network{n, &withoutDropout} {
+			actual := network.PredictTopK(example.Features, testNumClasses, true, &Scratch{})
+			assertPairsEqual(t, actual, expected[i], "scores")
+		}
+	}
+}
+
+func TestGradientClipping(t *testing.T) {
+	// the gradient norms are sqrt(901) and sqrt(10), including the bias
+	nodeNorm := []float64{math.Sqrt(901), math.Sqrt(10)}
+	globalNorm := math.Sqrt(911)
+
+	testCases := []struct {
+		clipping configuration.GradientClippingType
+		scale    []float64
+	}{
+		{configuration.NoGradientClipping, []float64{1, 1}},
+		{configuration.NodeGradientClipping, []float64{5 / nodeNorm[0], 1}},
+		{configuration.GlobalGradientClipping, []float64{5 / globalNorm, 5 / globalNorm}},
+	}
+
+	for _, tc := range testCases {
+		config := useDefaultConfiguration(t)
+		config.GradientClipping = tc.clipping
+		config.MaxGradientNorm = 5
+		n := newTestNetwork(t, 1, optimizer.NewSGD())
+		before := firstLayerParameters(n, 2)
+
+		injectGradients(n, 30, 3)
+		n.applyGradients(0, 0, true)
+
+		after := firstLayerParameters(n, 2)
+		for i, value := range []float64{30, 3} {
+			// with SGD and a learning rate of 0.1, the update is minus
+			// 0.1 times the clipped gradient
+			expected := before[i] + mat.Float(0.1*value*tc.scale[i])
+			assertFloatEqual(t, after[i], expected, "weight")
+		}
+	}
+}
+
+func TestNanPolicies(t *testing.T) {
+	policies := []configuration.NanPolicyType{
+		configuration.SkipBatchOnNan,
+		configuration.ReduceLearningRateOnNan,
+		configuration.RollbackOnNan,
+	}
+
+	for _, policy := range policies {
+		for _, value := range []float64{math.NaN(), math.Inf(1)} {
+			config := useDefaultConfiguration(t)
+			config.NanPolicy = policy
+			n := newTestNetwork(t, 1, optimizer.NewSGD())
+			n.saveCheckpoint()
+			checkpoint := firstLayerParameters(n, 1)
+
+			injectGradients(n, 1)
+			if !n.applyGradients(0, 0, true) {
+				t.Fatalf("finite update rejected with policy %d", policy)
+			}
+			updated := firstLayerParameters(n, 1)
+
+			injectGradients(n, mat.Float(value))
+			if n.applyGradients(0, 1, true) {
+				t.Fatalf("non-finite update %g applied with policy %d",
+					value, policy)
+			}
+
+			expected, factor := updated, 1.0
+			switch policy {
+			case configuration.ReduceLearningRateOnNan:
+				factor = config.NanDecayRate
+			case configuration.RollbackOnNan:
+				expected = checkpoint
+			}
+			assertFloatEqual(t, firstLayerParameters(n, 1)[0], expected[0],
+				"weight after non-finite update")
+			assertFloatEqual(t, firstLayerParameters(n, 1)[1], expected[1],
+				"bias after non-finite update")
+			assertFloatEqual(t, mat.Float(n.learningRateFactor),
+				mat.Float(factor), "learning rate factor")
+
+			// the non-finite gradients were discarded
+			if !n.applyGradients(0, 2, true) {
+				t.Errorf("gradients not discarded with policy %d", policy)
+			}
+		}
+	}
+}
+
+func TestPartialBatch(t *testing.T) {
+	useDefaultConfiguration(t)
+	examples := testExamples(1)
+
+	// the gradients are averaged over the actual number of examples,
+	// so a partial batch of the same example twice is like a full
+	// batch of that example alone
+	full := newTestNetwork(t, 1, optimizer.NewSGD())
+	partial := newTestNetwork(t, 4, optimizer.NewSGD())
+	for i, l := range partial.hiddenLayers {
+		l.Restore(0, full.hiddenLayers[i].Checkpoint())
+	}
+
+	full.ProcessInput(0, examples, 0, false, false)
+	partial.ProcessInput(0, append(examples, examples[0]), 0, false, false)
+
+	expected := allParameters(full)
+	actual := allParameters(partial)
+	for i := range expected {
+		assertFloatEqual(t, actual[i], expected[i], "parameter")
+	}
+
+	defer func() {
+		expected := "Batch of 5 examples exceeds the batch size 4."
+		if r := recover(); r != expected {
+			t.Errorf("expected panic %q, actual %v", expected, r)
+		}
+	}()
+	partial.ProcessInput(0, testExamples(5), 1, false, false)
+}
+
+// injectGradients accumulates gradients in the first nodes of the first
+// layer, as if each of them received a unit delta for an example whose
+// only feature is the first one, with the given value.
+func injectGradients(n *Network, values ...mat.Float) {
+	l := n.hiddenLayers[0]
+	l.Nodes().ResetExample(0, len(values))
+	for slot, value := range values {
+		nd := l.GetNodeById(slot)
+		nd.SetlastActivation(0, slot, 1)
+		nd.IncrementDelta(0, slot, 1)
+		nd.BackPropagateFirstLayer(
+			[]index_value.Pair{{Index: 0, Value: value}}, 0, slot)
+		l.MarkNodeTouched(slot)
+	}
+}
+
+// firstLayerParameters returns the first weight of each of the first
+// numNodes nodes of the first layer, followed by the bias of the first
+// node.
+func firstLayerParameters(n *Network, numNodes int) []mat.Float {
+	l := n.hiddenLayers[0]
+	params := make([]mat.Float, 0, numNodes+1)
+	for i := 0; i < numNodes; i++ {
+		params = append(params, l.GetNodeById(i).Weights()[0])
+	}
+	return append(params, l.GetNodeById(0).Bias())
+}
+
+// allParameters returns all the weights and biases of the network.
+func allParameters(n *Network) []mat.Float {
+	var params []mat.Float
+	for _, l := range n.hiddenLayers {
+		for i := 0; i < l.NumOfNodes(); i++ {
+			params = append(params, l.GetNodeById(i).Weights()...)
+			params = append(params, l.GetNodeById(i).Bias())
+		}
+	}
+	return params
+}
+
+// useDefaultConfiguration replaces the global configuration with the
+// default one for the duration of the test, and returns it.
+func useDefaultConfiguration(t *testing.T) *configuration.Configuration {
+	previous := configuration.Global
+	configuration.Global = configuration.Default()
+	t.Cleanup(func() {
+		configuration.Global = previous
+	})
+	return configuration.Global
+}
+
+// newTestNetwork creates a small network with a ReLU hidden layer and
+// a softmax output layer, where all nodes are always active.
+func newTestNetwork(t *testing.T, batchSize int, opt optimizer.Optimizer) *Network {
+	return New(
+		0,
+		2,
+		[]int{8, testNumClasses},
+		[]node.NodeType{node.ReLU, node.Softmax},
+		batchSize,
+		schedule.NewConstant(0.1),
+		opt,
+		testInputDim,
+		[]int{2, 2},
+		[]int{4, 4},
+		[]int{6, 6},
+		[]float64{1, 1, 1, 1},
+	)
+}
+
+// testExamples returns examples with random positive features and a
+// single label.
+func testExamples(numExamples int) []dataset.Example {
+	examples := make([]dataset.Example, numExamples)
+	for i := range examples {
+		features := make([]index_value.Pair, testInputDim)
+		for j := range features {
+			features[j] = index_value.Pair{
+				Index: j,
+				Value: mat.Float(rand.Float64()),
+			}
+		}
+		examples[i] = dataset.Example{
+			Features: features,
+			Labels:   []int{i % testNumClasses},
+		}
+	}
+	return examples
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
+
+func assertPairsEqual(t *testing.T, actual, expected []index_value.Pair, msg string) {
+	if len(actual) != len(expected) {
+		t.Errorf("Assertion failed: %s | expected %v, actual %v",
+			msg, expected, actual)
+		return
+	}
+	for i := range actual {
+		if actual[i].Index != expected[i].Index ||
+			math.Abs(float64(actual[i].Value-expected[i].Value)) > 1e-5 {
+			t.Errorf("Assertion failed: %s | expected %v, actual %v",
+				msg, expected, actual)
+			return
+		}
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual, expected mat.Float, msg string) {
+	if math.Abs(float64(actual-expected)) > 1e-5 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
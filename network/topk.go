@@ -0,0 +1,105 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"container/heap"
+	"sort"
+
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/index_value"
+)
+
+// PredictTopK returns the k labels with the highest softmax scores for
+// a single example, sorted by decreasing score. Fewer labels are
+// returned if less than k output nodes are active.
+//
+// If exact is true, the scores are computed over the full output layer.
+// Otherwise, only the output nodes retrieved from the hash tables are
+// considered, and the scores are normalized among them.
+//
+// Like Predict, it can be called concurrently, each call with its own
+// scratch.
+func (n *Network) PredictTopK(
+	features []index_value.Pair,
+	k int,
+	exact bool,
+	scratch *Scratch,
+) []index_value.Pair {
+	outputSparsity := n.sparsity[2*n.numberOfLayers-1]
+	if exact {
+		outputSparsity = 1
+	}
+	return topK(n.forward(features, outputSparsity, scratch), k)
+}
+
+// PredictTopKBatch calls PredictTopK for each example.
+func (n *Network) PredictTopKBatch(
+	examples []dataset.Example,
+	k int,
+	exact bool,
+) [][]index_value.Pair {
+	scratch := &Scratch{}
+	predictions := make([][]index_value.Pair, len(examples))
+	for i, example := range examples {
+		predictions[i] = n.PredictTopK(example.Features, k, exact, scratch)
+	}
+	return predictions
+}
+
+// topK returns a new slice with the k pairs with the highest values,
+// sorted by decreasing value, and by increasing index on ties.
+func topK(pairs []index_value.Pair, k int) []index_value.Pair {
+	if k > len(pairs) {
+		k = len(pairs)
+	}
+	if k <= 0 {
+		return []index_value.Pair{}
+	}
+
+	h := make(pairMinHeap, 0, k)
+	for _, pair := range pairs {
+		if len(h) < k {
+			heap.Push(&h, pair)
+		} else if h.less(h[0], pair) {
+			h[0] = pair
+			heap.Fix(&h, 0)
+		}
+	}
+
+	result := []index_value.Pair(h)
+	sort.Slice(result, func(i, j int) bool {
+		return h.less(result[j], result[i])
+	})
+	return result
+}
+
+// pairMinHeap is a heap of pairs, where the root is the pair with the
+// lowest value, or with the highest index on ties.
+type pairMinHeap []index_value.Pair
+
+var _ heap.Interface = &pairMinHeap{}
+
+func (h pairMinHeap) Len() int           { return len(h) }
+func (h pairMinHeap) Less(i, j int) bool { return h.less(h[i], h[j]) }
+func (h pairMinHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *pairMinHeap) Push(x interface{}) {
+	*h = append(*h, x.(index_value.Pair))
+}
+
+func (h *pairMinHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func (pairMinHeap) less(a, b index_value.Pair) bool {
+	if a.Value == b.Value {
+		return a.Index > b.Index
+	}
+	return a.Value < b.Value
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package network
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/optimizer"
+)
+
+func TestTopK(t *testing.T) {
+	pairs := []index_value.Pair{
+		{Index: 4, Value: 0.1},
+		{Index: 7, Value: 0.3},
+		{Index: 2, Value: 0.2},
+		{Index: 5, Value: 0.3},
+		{Index: 1, Value: 0.2},
+		{Index: 9, Value: 0.3},
+	}
+	// sorted by decreasing value, and by increasing index on ties
+	sorted := []index_value.Pair{
+		{Index: 5, Value: 0.3},
+		{Index: 7, Value: 0.3},
+		{Index: 9, Value: 0.3},
+		{Index: 1, Value: 0.2},
+		{Index: 2, Value: 0.2},
+		{Index: 4, Value: 0.1},
+	}
+
+	for k := 0; k <= len(pairs)+1; k++ {
+		expected := sorted
+		if k < len(sorted) {
+			expected = sorted[:k]
+		}
+		assertPairsEqual(t, topK(pairs, k), expected, "top k")
+	}
+	assertPairsEqual(t, topK(pairs, -1), []index_value.Pair{}, "negative k")
+	assertPairsEqual(t, topK(nil, 3), []index_value.Pair{}, "no pairs")
+
+	// the given pairs are not changed
+	assertPairsEqual(t, pairs[:2], []index_value.Pair{
+		{Index: 4, Value: 0.1},
+		{Index: 7, Value: 0.3},
+	}, "input pairs")
+}
+
+func TestPredictTopK(t *testing.T) {
+	useDefaultConfiguration(t)
+	n := newTestNetwork(t, 4, optimizer.NewSGD())
+	examples := testExamples(4)
+	n.ProcessInput(0, examples, 0, false, false)
+
+	for _, example := range examples {
+		scratch := &Scratch{}
+		predictions := n.PredictTopK(example.Features, testNumClasses, true, scratch)
+		assertIntEqual(t, len(predictions), testNumClasses, "predictions")
+
+		var sum float64
+		for i, p := range predictions {
+			sum += float64(p.Value)
+			if i > 0 && (pairMinHeap{}).less(predictions[i-1], p) {
+				t.Errorf("predictions not sorted: %v", predictions)
+			}
+		}
+		assertFloatEqual(t, mat.Float(sum), 1, "sum of the scores")
+
+		assertIntEqual(t, predictions[0].Index,
+			n.Predict(example.Features, scratch), "best prediction")
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package node
+
+import (
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/optimizer"
+)
+
+// GradientSquaredNorm returns the squared L2 norm of the gradients
+// accumulated since the last update, including the bias.
+func (n Node) GradientSquaredNorm() mat.Float {
+	tBias := n.s.tBias[n.id]
+	sum := tBias * tBias
+	t := n.row(n.s.t)
+	if n.s.sparse != nil {
+		for _, i := range n.s.sparse.touched[n.id] {
+			sum += t[i] * t[i]
+		}
+		return sum
+	}
+	for _, g := range t {
+		sum += g * g
+	}
+	return sum
+}
+
+// ScaleGradients multiplies the gradients accumulated since the last
+// update by the given factor.
+func (n Node) ScaleGradients(factor mat.Float) {
+	n.s.tBias[n.id] *= factor
+	t := n.row(n.s.t)
+	if n.s.sparse != nil {
+		for _, i := range n.s.sparse.touched[n.id] {
+			t[i] *= factor
+		}
+		return
+	}
+	for i := range t {
+		t[i] *= factor
+	}
+}
+
+// ClipGradients rescales the gradients accumulated since the last
+// update, if needed, so that their L2 norm does not exceed maxNorm.
+func (n Node) ClipGradients(maxNorm mat.Float) {
+	norm := mat.Sqrt(n.GradientSquaredNorm())
+	if norm <= maxNorm {
+		return
+	}
+	n.ScaleGradients(maxNorm / norm)
+}
+
+// DiscardGradients resets the gradients accumulated since the last
+// update, without changing the parameters.
+func (n Node) DiscardGradients() {
+	n.s.tBias[n.id] = 0
+	t := n.row(n.s.t)
+	if sp := n.s.sparse; sp != nil {
+		mask := sp.touchedMask[n.id*sp.maskWords : (n.id+1)*sp.maskWords]
+		for _, i := range sp.touched[n.id] {
+			t[i] = 0
+			mask[i/64] = 0
+		}
+		sp.touched[n.id] = sp.touched[n.id][:0]
+		return
+	}
+	for i := range t {
+		t[i] = 0
+	}
+}
+
+// UpdateIsFinite reports whether updating the parameters with the
+// gradients accumulated since the last update would result in finite
+// weights, bias and moments. Nothing is changed: the update is computed
+// on copies, only for the parameters which would be updated.
+//
+// The arguments are the same as ApplySparseGradients with sparse
+// updates, where the steps are those of each weight, otherwise the
+// step is iter + 1 as for ApplyGradients.
+func (n Node) UpdateIsFinite(
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	iter int,
+	reg Regularization,
+) bool {
+	s := n.s
+	weights := n.Weights()
+	t := n.row(s.t)
+	firstMoments := n.row(s.firstMoments)
+	secondMoments := n.row(s.secondMoments)
+
+	update := func(param, grad mat.Float, m, v *mat.Float, step int) bool {
+		opt.Update(&param, grad, m, v, learningRate, step)
+		return mat.IsFinite(param) &&
+			(m == nil || mat.IsFinite(*m)) &&
+			(v == nil || mat.IsFinite(*v))
+	}
+	weightIsFinite := func(i int, w mat.Float, step int) bool {
+		m, v := copyElementAt(firstMoments, i), copyElementAt(secondMoments, i)
+		return update(w, t[i]+reg.L2*w, m, v, step)
+	}
+
+	biasStep := iter + 1
+	if sp := s.sparse; sp != nil {
+		steps := n.row32(sp.steps)
+		lastIter := n.row32(sp.lastIter)
+		decay := decayFactor(opt, learningRate, reg)
+		for _, i := range sp.touched[n.id] {
+			w := weights[i]
+			if decay != 1 {
+				last := -1
+				if lastIter != nil {
+					last = int(lastIter[i])
+				}
+				if skipped := iter - last - 1; skipped > 0 {
+					w *= mat.Pow(decay, mat.Float(skipped))
+				}
+			}
+			if !weightIsFinite(i, w, int(steps[i])+1) {
+				return false
+			}
+		}
+		biasStep = int(sp.biasSteps[n.id]) + 1
+	} else {
+		for i, w := range weights {
+			if !weightIsFinite(i, w, iter+1) {
+				return false
+			}
+		}
+	}
+
+	m, v := s.firstMomentBias[n.id], s.secondMomentBias[n.id]
+	return update(s.bias[n.id], s.tBias[n.id], &m, &v, biasStep)
+}
+
+// copyElementAt returns a pointer to a copy of the i-th element of the
+// slice, or nil if the slice is nil.
+func copyElementAt(slice []mat.Float, i int) *mat.Float {
+	if slice == nil {
+		return nil
+	}
+	value := slice[i]
+	return &value
+}
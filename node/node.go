@@ -5,529 +5,427 @@
 package node
 
 import (
-	"github.com/nlpodyssey/goslide/configuration"
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/optimizer"
+	"github.com/nlpodyssey/goslide/quantization"
 )
 
+// Node is a lightweight view of a single node of a Storage.
 type Node struct {
-	cowId int // "thread" ID for copy on write
-	base  *baseNode
-	train []*NodeTrain
-}
-
-type baseNode struct {
-	cowId            int // "thread" ID for copy on write
-	nodeType         NodeType
-	currentBatchsize int
-	idInLayer        int
-	weights          []float64
-	mirrorWeights    []float64
-	adamAvgMom       []float64
-	adamAvgVel       []float64
-	t                []float64 // for adam
-	bias             float64
-	tBias            float64
-	adamAvgMomBias   float64
-	adamAvgVelBias   float64
-	mirrorBias       float64
-}
-
-type NodeTrain struct {
-	cowId           int // "thread" ID for copy on write
-	lastDeltaforBPs float64
-	lastActivations float64
-	activeinputIds  float64
-}
-
-func NewNodeTrain(cowId int) *NodeTrain {
-	return &NodeTrain{
-		cowId: cowId,
+	s  *Storage
+	id int
+}
+
+// Regularization parameters applied when updating the weights.
+type Regularization struct {
+	// L2 is the coefficient of the L2 penalty added to the loss,
+	// resulting in a weight decay. Zero disables it.
+	L2 mat.Float
+	// MaxNorm is the maximum L2 norm of the weights vector. Weights
+	// exceeding it are rescaled after the update. Zero disables it.
+	MaxNorm mat.Float
+}
+
+func (n Node) Id() int {
+	return n.id
+}
+
+func (n Node) Weights() []mat.Float {
+	return n.row(n.s.weights)
+}
+
+func (n Node) Bias() mat.Float {
+	return n.s.bias[n.id]
+}
+
+// ApplyGradients updates all weights and the bias with the given
+// optimizer, using the gradients accumulated since the previous call,
+// which are then reset.
+func (n Node) ApplyGradients(
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	step int,
+	reg Regularization,
+) {
+	s := n.s
+	weights := n.Weights()
+	t := n.row(s.t)
+	firstMoments := n.row(s.firstMoments)
+	secondMoments := n.row(s.secondMoments)
+
+	for i := range weights {
+		opt.Update(
+			&weights[i],
+			t[i]+reg.L2*weights[i],
+			elementAt(firstMoments, i),
+			elementAt(secondMoments, i),
+			learningRate,
+			step,
+		)
+		t[i] = 0
 	}
-}
 
-func NewEmptyNode(cowId int) *Node {
-	return &Node{
-		cowId: cowId,
-		base:  &baseNode{cowId: cowId},
-		train: nil,
+	if s.sparse != nil {
+		s.sparse.sqNorms = nil // computed again by the sparse updates
 	}
-}
-
-func NewNode(
-	cowId int,
-	adamTDim int,
-	nodeId int,
-	layerId int,
-	nodeType NodeType,
-	batchsize int,
-	weights []float64,
-	bias float64,
-	adamAvgMom []float64,
-	adamAvgVel []float64,
-) *Node {
-	newNode := &Node{
-		cowId: cowId,
-		base: &baseNode{
-			cowId:            cowId,
-			idInLayer:        nodeId,
-			nodeType:         nodeType,
-			currentBatchsize: batchsize,
-			weights:          weights,
-			bias:             bias,
-			mirrorBias:       bias,
-			mirrorWeights:    weights, // TODO: correct? not present in C++
-		},
-		train: nil,
+	n.applyBiasGradient(opt, learningRate, step)
+	n.applyMaxNorm(reg.MaxNorm)
+}
+
+// ApplySparseGradients is like ApplyGradients, but it only updates the
+// weights which received a gradient since the previous call. The step
+// given to the optimizer is the number of updates of each weight.
+//
+// The L2 weight decay a weight missed while not being updated, since
+// the previous update, is applied before the current one, as plain
+// gradient descent steps at the current learning rate, and so is the
+// decoupled weight decay of an optimizer.WeightDecayer. The moments of
+// the optimizer are not caught up, so the updates differ from the
+// dense ones for optimizers with moments, such as AdamW.
+//
+// The max-norm constraint uses the squared norm of the weights of the
+// node, updated with the touched weights only, so that the cost is
+// proportional to their number, unless the weights are rescaled.
+//
+// It panics if the storage was not created for sparse updates.
+func (n Node) ApplySparseGradients(
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	iter int,
+	reg Regularization,
+) {
+	s := n.s
+	sp := s.sparse
+
+	decay := decayFactor(opt, learningRate, reg)
+	if decay != 1 && sp.lastIter == nil {
+		sp.lastIter = make([]int32, len(s.weights))
+		for i := range sp.lastIter {
+			sp.lastIter[i] = -1
+		}
 	}
-
-	if configuration.Global.UseAdam {
-		newNode.base.adamAvgMom = adamAvgMom
-		newNode.base.adamAvgVel = adamAvgVel
-		newNode.base.t = make([]float64, adamTDim)
+	if reg.MaxNorm > 0 && sp.sqNorms == nil {
+		sp.sqNorms = make([]mat.Float, s.numNodes)
+		for id := range sp.sqNorms {
+			sp.sqNorms[id] = squaredNorm(s.Node(id).Weights())
+		}
 	}
 
-	train := make([]*NodeTrain, batchsize)
-	for i := range train {
-		train[i] = NewNodeTrain(cowId)
+	weights := n.Weights()
+	t := n.row(s.t)
+	firstMoments := n.row(s.firstMoments)
+	secondMoments := n.row(s.secondMoments)
+	steps := n.row32(sp.steps)
+	lastIter := n.row32(sp.lastIter)
+	mask := sp.touchedMask[n.id*sp.maskWords : (n.id+1)*sp.maskWords]
+
+	var sqNorm mat.Float
+	if sp.sqNorms != nil {
+		sqNorm = sp.sqNorms[n.id]
 	}
-	newNode.train = train
-
-	return newNode
-}
-
-func (n *Node) Weights() []float64 {
-	return n.base.weights
-}
-
-func (n *Node) Bias() float64 {
-	return n.base.bias
-}
-
-func (n *Node) AdamTDim() int {
-	return len(n.base.t)
-}
-
-func (n *Node) GetT(i int) float64 {
-	return n.base.t[i]
-}
-
-func (nd *Node) SetT(cowId, i int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.t[i] = value
-	return n
-}
-
-func (n *Node) GetAdamAvgMom(i int) float64 {
-	return n.base.adamAvgMom[i]
-}
-
-func (nd *Node) SetAdamAvgMom(cowId, i int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.adamAvgMom[i] = value
-	return n
-}
-
-func (n *Node) GetAdamAvgVel(i int) float64 {
-	return n.base.adamAvgVel[i]
-}
-
-func (nd *Node) SetAdamAvgVel(cowId, i int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.adamAvgVel[i] = value
-	return n
-}
-
-func (n *Node) GetAdamAvgMomBias() float64 {
-	return n.base.adamAvgMomBias
-}
-
-func (nd *Node) SetAdamAvgMomBias(cowId int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.adamAvgMomBias = value
-	return n
-}
-
-func (n *Node) GetAdamAvgVelBias() float64 {
-	return n.base.adamAvgVelBias
-}
 
-func (nd *Node) SetAdamAvgVelBias(cowId int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.adamAvgVelBias = value
-	return n
-}
-
-func (n *Node) GetBias() float64 {
-	return n.base.bias
-}
+	for _, i := range sp.touched[n.id] {
+		sqNorm -= weights[i] * weights[i]
+		if decay != 1 {
+			if skipped := iter - int(lastIter[i]) - 1; skipped > 0 {
+				weights[i] *= mat.Pow(decay, mat.Float(skipped))
+			}
+			lastIter[i] = int32(iter)
+		}
 
-func (nd *Node) SetBias(cowId int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.bias = value
-	return n
+		steps[i]++
+		opt.Update(
+			&weights[i],
+			t[i]+reg.L2*weights[i],
+			elementAt(firstMoments, i),
+			elementAt(secondMoments, i),
+			learningRate,
+			int(steps[i]),
+		)
+		t[i] = 0
+		mask[i/64] = 0
+		sqNorm += weights[i] * weights[i]
+	}
+	sp.touched[n.id] = sp.touched[n.id][:0]
+
+	sp.biasSteps[n.id]++
+	n.applyBiasGradient(opt, learningRate, int(sp.biasSteps[n.id]))
+	if reg.MaxNorm > 0 {
+		// the rounding errors can make it slightly negative
+		if sqNorm < 0 {
+			sqNorm = 0
+		}
+		sp.sqNorms[n.id] = n.clipNorm(reg.MaxNorm, sqNorm)
+	}
 }
 
-func (n *Node) GetTBias() float64 {
-	return n.base.tBias
+// decayFactor returns the factor by which a weight decays at each
+// update, with L2 regularization and the decoupled weight decay of the
+// optimizer, if any, or 1 without decay.
+func decayFactor(
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	reg Regularization,
+) mat.Float {
+	factor := 1 - learningRate*reg.L2
+	if wd, ok := opt.(optimizer.WeightDecayer); ok {
+		factor *= 1 - learningRate*wd.WeightDecay()
+	}
+	return factor
 }
 
-func (nd *Node) SetTBias(cowId int, value float64) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	n.base.tBias = value
-	return n
-}
+// The following methods access the activation and the delta of the
+// node for the example with the given input ID, where slot is the
+// position of the node in the active nodes list of the example (see
+// Storage.ResetExample).
 
-func (nd *Node) CopyWeightsAndBiasFromMirror(cowId int) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-	copy(n.base.weights, n.base.mirrorWeights)
-	n.base.bias = n.base.mirrorBias
-	return n
+func (n Node) GetLastActivation(inputId, slot int) mat.Float {
+	return n.buffer(inputId, slot).activations[slot]
 }
 
-func (nd *Node) Update(
-	cowId int,
-	adamTDim int,
-	nodeId int,
-	layerId int,
-	nodeType NodeType,
-	batchsize int,
-	weights []float64,
-	bias float64,
-	adamAvgMom []float64,
-	adamAvgVel []float64,
-	trainBlob []*NodeTrain,
-) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-
-	n.base.idInLayer = nodeId
-	n.base.nodeType = nodeType
-	n.base.currentBatchsize = batchsize
-	n.base.weights = weights
-	n.base.bias = bias
-	n.base.mirrorBias = bias
-	n.base.mirrorWeights = weights // TODO: correct? not present in C++
-
-	if configuration.Global.UseAdam {
-		n.base.adamAvgMom = adamAvgMom
-		n.base.adamAvgVel = adamAvgVel
-		n.base.t = make([]float64, adamTDim)
+func (n Node) IncrementDelta(inputId, slot int, incrementValue mat.Float) {
+	b := n.buffer(inputId, slot)
+	if b.activations[slot] <= 0 {
+		return
 	}
-
-	n.train = trainBlob
-
-	return n
+	b.deltas[slot] += incrementValue
 }
 
-func (n *Node) GetLastActivation(inputId int) float64 {
-	t := n.train[inputId]
-	if t.activeinputIds != 1 {
-		return 0
-	}
-	return t.lastActivations
+func (n Node) GetActivation(
+	data []index_value.Pair,
+	inputId int,
+	slot int,
+) mat.Float {
+	return n.activate(inputId, slot, n.weightedSum(data))
 }
 
-func (nd *Node) IncrementDelta(
-	cowId, inputId int,
-	incrementValue float64,
-) *Node {
-	if nd.train[inputId].activeinputIds != 1 {
-		panic("Input Not Active but still called")
-	} else if nd.train[inputId].lastActivations <= 0 {
-		return nd
-	}
-
-	n := nd.cloneIfNeeded(cowId)
-	train := n.train
-	train[inputId] = train[inputId].cloneIfNeeded(cowId)
-	train[inputId].lastDeltaforBPs += incrementValue
-	return n
+// Activation returns the activation of the node for the given input,
+// without storing it. For softmax nodes, it is the value before the
+// exponentiation and the normalization.
+func (n Node) Activation(data []index_value.Pair) mat.Float {
+	return n.activationFunction(n.weightedSum(data) + n.Bias())
 }
 
-func (nd *Node) GetActivation(
-	cowId int,
+// QuantizedActivation is like Activation, but it uses the given
+// quantized copy of the node weights.
+func (n Node) QuantizedActivation(
 	data []index_value.Pair,
-	inputId int,
-) (float64, *Node) {
-	if inputId > nd.base.currentBatchsize {
-		panic("Input ID more than Batch Size")
-	}
-
-	//FUTURE TODO: shrink batchsize and check if input is already active then ignore and ensure backpopagation is ignored too.
-
-	n := nd.cloneIfNeeded(cowId)
-	train := n.train
-	train[inputId] = train[inputId].cloneIfNeeded(cowId)
-
-	if train[inputId].activeinputIds != 1 {
-		train[inputId].activeinputIds = 1 // activate input
-
-		n.base = n.base.cloneIfNeeded(cowId)
-	}
+	weights quantization.Vector,
+) mat.Float {
+	return n.activationFunction(weights.Dot(data) + n.Bias())
+}
 
-	train[inputId].lastActivations = 0
+// activate sets the activation of the node for the given input,
+// from the weighted sum of the previous layer activations.
+func (n Node) activate(inputId, slot int, weightedSum mat.Float) mat.Float {
+	b := n.buffer(inputId, slot)
+	activation := n.activationFunction(weightedSum + n.Bias())
+	b.activations[slot] = activation
+	return activation
+}
 
+func (n Node) weightedSum(data []index_value.Pair) mat.Float {
+	weights := n.Weights()
+	var sum mat.Float = 0
 	for _, pair := range data {
-		train[inputId].lastActivations +=
-			n.base.weights[pair.Index] * pair.Value
+		sum += weights[pair.Index] * pair.Value
 	}
+	return sum
+}
 
-	train[inputId].lastActivations += n.base.bias
-
-	switch n.base.nodeType {
+func (n Node) activationFunction(x mat.Float) mat.Float {
+	switch n.s.nodeType {
 	case ReLU:
-		if train[inputId].lastActivations < 0 {
-			train[inputId].lastActivations = 0
-			train[inputId].lastDeltaforBPs = 0
+		if x < 0 {
+			return 0
 		}
+		return x
 	case Softmax: // do nothing
+		return x
 	default:
 		panic("Invalid Node type from Constructor")
 	}
-
-	return train[inputId].lastActivations, n
 }
 
-func (nd *Node) ComputeExtaStatsForSoftMax(
-	cowId int,
-	normalizationConstant float64,
+// ComputeExtaStatsForSoftMax normalizes the softmax activation, and
+// sets the delta of the cross-entropy loss, averaged over a batch of
+// batchLength examples.
+func (n Node) ComputeExtaStatsForSoftMax(
+	normalizationConstant mat.Float,
 	inputId int,
+	slot int,
 	labels []int,
-) *Node {
-	if nd.train[inputId].activeinputIds != 1 {
-		panic("Input Not Active but still called")
-	}
-
-	n := nd.cloneIfNeeded(cowId)
-	train := n.train
-	train[inputId] = train[inputId].cloneIfNeeded(cowId)
+	batchLength int,
+) {
+	b := n.buffer(inputId, slot)
+	batchSize := mat.Float(batchLength)
 
-	train[inputId].lastActivations /= normalizationConstant + 0.0000001
+	b.activations[slot] /= normalizationConstant + 0.0000001
 
 	//TODO:check gradient
 
-	if intSliceContains(labels, n.base.idInLayer) {
-		train[inputId].lastDeltaforBPs = 1.0/float64(len(labels)) -
-			train[inputId].lastActivations/float64(n.base.currentBatchsize)
+	if intSliceContains(labels, n.id) {
+		b.deltas[slot] = (1.0/mat.Float(len(labels)) -
+			b.activations[slot]) / batchSize
 	} else {
-		train[inputId].lastDeltaforBPs = -train[inputId].lastActivations /
-			float64(n.base.currentBatchsize)
+		b.deltas[slot] = -b.activations[slot] / batchSize
 	}
-
-	return n
 }
 
-func (nd *Node) BackPropagate(
-	cowId int,
-	previousNodes *[]*Node,
+// BackPropagate accumulates the gradients of the node parameters,
+// and increments the deltas of the previous layer active nodes.
+//
+// previousLayerScale is the factor the previous layer activations were
+// multiplied by, as with inverted dropout, or 1.
+func (n Node) BackPropagate(
+	previousNodes *Storage,
 	previousLayerActiveNodes []index_value.Pair,
-	learningRate float64,
+	previousLayerScale mat.Float,
 	inputId int,
-) *Node {
-	if nd.train[inputId].activeinputIds != 1 {
-		panic("Input Not Active but still called")
-	}
+	slot int,
+) {
+	delta := n.buffer(inputId, slot).deltas[slot]
+	weights := n.Weights()
 
-	n := nd.cloneIfNeeded(cowId)
-	train := n.train
-	train[inputId] = train[inputId].cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-
-	for _, pair := range previousLayerActiveNodes {
+	for prevSlot, pair := range previousLayerActiveNodes {
 		var nodeId = pair.Index
 
 		// Update Delta before updating weights
-		prevNode := (*previousNodes)[nodeId].IncrementDelta(
-			cowId,
-			inputId,
-			train[inputId].lastDeltaforBPs*n.base.weights[nodeId])
-		(*previousNodes)[nodeId] = prevNode
-
-		gradT := train[inputId].lastDeltaforBPs *
-			prevNode.GetLastActivation(inputId)
-
-		if configuration.Global.UseAdam {
-			n.base.t[nodeId] += gradT
-		} else {
-			n.base.mirrorWeights[nodeId] += learningRate * gradT
-		}
-	}
-
-	if configuration.Global.UseAdam {
-		biasgradT := train[inputId].lastDeltaforBPs
-		// TODO: ?? biasgradTsq := biasgradT * biasgradT
-		n.base.tBias += biasgradT
-	} else {
-		n.base.mirrorBias += learningRate * train[inputId].lastDeltaforBPs
+		prevNode := previousNodes.Node(nodeId)
+		prevNode.IncrementDelta(
+			inputId, prevSlot, delta*weights[nodeId]*previousLayerScale)
+
+		// The delta is the negative gradient of the loss
+		// with respect to the node pre-activation.
+		n.accumulateGradient(nodeId,
+			-delta*prevNode.GetLastActivation(inputId, prevSlot))
 	}
 
-	train[inputId].activeinputIds = 0
-	train[inputId].lastDeltaforBPs = 0
-	train[inputId].lastActivations = 0
-
-	return n
+	n.s.tBias[n.id] -= delta
 }
 
-func (nd *Node) BackPropagateFirstLayer(
-	cowId int,
+func (n Node) BackPropagateFirstLayer(
 	indexValuePairs []index_value.Pair,
-	learningRate float64,
 	inputId int,
-) *Node {
-	if nd.train[inputId].activeinputIds != 1 {
-		panic("Input Not Active but still called")
-	}
-
-	n := nd.cloneIfNeeded(cowId)
-	train := n.train
-	train[inputId] = train[inputId].cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
+	slot int,
+) {
+	delta := n.buffer(inputId, slot).deltas[slot]
 
 	for _, pair := range indexValuePairs {
-		gradT := train[inputId].lastDeltaforBPs * pair.Value
-		// TODO: ?? gradTsq := gradT * gradT
-		if configuration.Global.UseAdam {
-			n.base.t[pair.Index] += gradT
-		} else {
-			n.base.mirrorWeights[pair.Index] += learningRate * gradT
-		}
+		n.accumulateGradient(pair.Index, -delta*pair.Value)
 	}
 
-	if configuration.Global.UseAdam {
-		biasgradT := train[inputId].lastDeltaforBPs
-		// TODO: ?? biasgradTsq = biasgradT * biasgradT
-		n.base.tBias += biasgradT
-	} else {
-		n.base.mirrorBias += learningRate + train[inputId].lastDeltaforBPs
-	}
-
-	train[inputId].activeinputIds = 0 // deactivate inputIDs
-	train[inputId].lastDeltaforBPs = 0
-	train[inputId].lastActivations = 0
-
-	return n
+	n.s.tBias[n.id] -= delta
 }
 
-func (nd *Node) SetlastActivation(
-	cowId int,
-	inputId int,
-	realActivation float64,
-) *Node {
-	n := nd.cloneIfNeeded(cowId)
-	train := n.train
-	train[inputId] = train[inputId].cloneIfNeeded(cowId)
-
-	train[inputId].lastActivations = realActivation
-
-	return n
+func (n Node) SetlastActivation(inputId, slot int, realActivation mat.Float) {
+	n.buffer(inputId, slot).activations[slot] = realActivation
 }
 
 // for debugging gradients.
-func (nd *Node) PurturbWeight(
-	cowId int,
-	weightId int,
-	delta float64,
-) (float64, *Node) {
-	n := nd.cloneIfNeeded(cowId)
-	n.base = n.base.cloneIfNeeded(cowId)
-
-	weights := n.base.weights
+func (n Node) PurturbWeight(weightId int, delta mat.Float) mat.Float {
+	weights := n.Weights()
 	weights[weightId] += delta
-
-	return weights[weightId], n
+	return weights[weightId]
 }
 
-func (n *Node) GetGradient(
-	cowId int,
-	weightId, inputId int,
-	inputVal float64,
-) float64 {
-	return -n.train[inputId].lastDeltaforBPs * inputVal
+func (n Node) GetGradient(
+	weightId, inputId, slot int,
+	inputVal mat.Float,
+) mat.Float {
+	return -n.buffer(inputId, slot).deltas[slot] * inputVal
 }
 
-func (n *Node) cloneIfNeeded(cowId int) *Node {
-	if n.cowId != cowId {
-		return n.clone(cowId)
+// buffer returns the buffer of the given example, checking that the
+// slot is active.
+func (n Node) buffer(inputId, slot int) *exampleBuffer {
+	b := &n.s.examples[inputId]
+	if slot >= len(b.activations) {
+		panic("Input Not Active but still called")
 	}
-	return n
+	return b
 }
 
-func (n *Node) clone(cowId int) *Node {
-	newNode := &Node{
-		cowId: cowId,
-		base:  n.base,
-		train: nil,
+func (n Node) accumulateGradient(i int, value mat.Float) {
+	n.s.t[n.id*n.s.dim+i] += value
+	if n.s.sparse != nil {
+		n.s.sparse.touch(n.id, i)
 	}
+}
 
-	if n.train != nil {
-		newNode.train = make([]*NodeTrain, len(n.train))
-		copy(newNode.train, n.train)
+func (n Node) applyBiasGradient(
+	opt optimizer.Optimizer,
+	learningRate mat.Float,
+	step int,
+) {
+	s := n.s
+	opt.Update(
+		&s.bias[n.id],
+		s.tBias[n.id],
+		&s.firstMomentBias[n.id],
+		&s.secondMomentBias[n.id],
+		learningRate,
+		step,
+	)
+	s.tBias[n.id] = 0
+}
+
+func (n Node) applyMaxNorm(maxNorm mat.Float) {
+	if maxNorm <= 0 {
+		return
 	}
 
-	return newNode
+	n.clipNorm(maxNorm, squaredNorm(n.Weights()))
 }
 
-func (n *baseNode) cloneIfNeeded(cowId int) *baseNode {
-	if n.cowId != cowId {
-		return n.clone(cowId)
+// clipNorm rescales the weights to maxNorm, if their squared norm
+// sqNorm is greater, and returns their squared norm afterwards.
+func (n Node) clipNorm(maxNorm, sqNorm mat.Float) mat.Float {
+	norm := mat.Sqrt(sqNorm)
+	if norm <= maxNorm {
+		return sqNorm
 	}
-	return n
-}
-
-func (n *baseNode) clone(cowId int) *baseNode {
-	// TODO: not sure we should clone all slices...
-	return &baseNode{
-		cowId:            cowId,
-		nodeType:         n.nodeType,
-		currentBatchsize: n.currentBatchsize,
-		idInLayer:        n.idInLayer,
-		weights:          copyFloat64Slice(n.weights),
-		mirrorWeights:    copyFloat64Slice(n.mirrorWeights),
-		adamAvgMom:       copyFloat64Slice(n.adamAvgMom),
-		adamAvgVel:       copyFloat64Slice(n.adamAvgVel),
-		t:                copyFloat64Slice(n.t),
-		bias:             n.bias,
-		tBias:            n.tBias,
-		adamAvgMomBias:   n.adamAvgMomBias,
-		adamAvgVelBias:   n.adamAvgVelBias,
-		mirrorBias:       n.mirrorBias,
+
+	weights := n.Weights()
+	scale := maxNorm / norm
+	sqNorm = 0
+	for i := range weights {
+		weights[i] *= scale
+		sqNorm += weights[i] * weights[i]
 	}
+	return sqNorm
 }
 
-func (n *NodeTrain) cloneIfNeeded(cowId int) *NodeTrain {
-	if n.cowId != cowId {
-		return n.clone(cowId)
+func squaredNorm(weights []mat.Float) mat.Float {
+	var sqNorm mat.Float = 0
+	for _, w := range weights {
+		sqNorm += w * w
 	}
-	return n
+	return sqNorm
 }
 
-func (t *NodeTrain) clone(cowId int) *NodeTrain {
-	return &NodeTrain{
-		cowId:           cowId,
-		lastDeltaforBPs: t.lastDeltaforBPs,
-		lastActivations: t.lastActivations,
-		activeinputIds:  t.activeinputIds,
+// row returns the elements of a weights-sized matrix which belong to
+// the node, or nil if the matrix is nil.
+func (n Node) row(matrix []mat.Float) []mat.Float {
+	if matrix == nil {
+		return nil
 	}
+	return matrix[n.id*n.s.dim : (n.id+1)*n.s.dim]
 }
 
-func copyIntSlice(s []int) []int {
-	newS := make([]int, len(s))
-	copy(newS, s)
-	return s
+func (n Node) row32(matrix []int32) []int32 {
+	if matrix == nil {
+		return nil
+	}
+	return matrix[n.id*n.s.dim : (n.id+1)*n.s.dim]
 }
 
-func copyFloat64Slice(s []float64) []float64 {
-	newS := make([]float64, len(s))
-	copy(newS, s)
-	return s
+func elementAt(slice []mat.Float, i int) *mat.Float {
+	if slice == nil {
+		return nil
+	}
+	return &slice[i]
 }
 
 func intSliceContains(slice []int, value int) bool {
@@ -0,0 +1,282 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package node
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/optimizer"
+)
+
+// stepRecorder is an SGD optimizer which records the steps of the
+// updates of each parameter.
+type stepRecorder struct {
+	steps map[*mat.Float][]int
+}
+
+func newStepRecorder() *stepRecorder {
+	return &stepRecorder{steps: make(map[*mat.Float][]int)}
+}
+
+func (o *stepRecorder) Moments() (first, second bool) {
+	return false, false
+}
+
+func (o *stepRecorder) Update(param *mat.Float, grad mat.Float, _, _ *mat.Float, lr mat.Float, step int) {
+	o.steps[param] = append(o.steps[param], step)
+	*param -= lr * grad
+}
+
+func TestApplySparseGradientsSteps(t *testing.T) {
+	s := newTestStorage(t, true, 1, 3, false)
+	n := s.Node(0)
+	opt := newStepRecorder()
+
+	for iter, touched := range [][]int{{0, 2}, {2}, {0, 2}} {
+		for _, i := range touched {
+			n.accumulateGradient(i, 1)
+		}
+		n.ApplySparseGradients(opt, 0.1, iter, Regularization{})
+	}
+
+	weights := n.Weights()
+	assertIntSliceEqual(t, opt.steps[&weights[0]], []int{1, 2}, "weight 0 steps")
+	assertIntSliceEqual(t, opt.steps[&weights[1]], nil, "weight 1 steps")
+	assertIntSliceEqual(t, opt.steps[&weights[2]], []int{1, 2, 3}, "weight 2 steps")
+	assertIntSliceEqual(t, opt.steps[&s.bias[0]], []int{1, 2, 3}, "bias steps")
+
+	assertFloatEqual(t, weights[0], 0.8, "weight 0")
+	assertFloatEqual(t, weights[1], 1, "untouched weight")
+	assertFloatEqual(t, weights[2], 0.7, "weight 2")
+}
+
+func TestApplySparseGradientsAdam(t *testing.T) {
+	s := newTestStorage(t, true, 1, 2, true)
+	n := s.Node(0)
+	opt := optimizer.NewAdam(0.9, 0.999, 1e-8)
+
+	// weight 0 is touched at iterations 0 and 5 only, so its second
+	// update is bias-corrected as the second step, not the sixth
+	gradients := map[int]mat.Float{0: 0.5, 5: -2}
+	for iter := 0; iter < 6; iter++ {
+		if g, ok := gradients[iter]; ok {
+			n.accumulateGradient(0, g)
+		}
+		n.accumulateGradient(1, 1)
+		n.ApplySparseGradients(opt, 0.1, iter, Regularization{})
+	}
+
+	var expected, m, v mat.Float = 1, 0, 0
+	opt.Update(&expected, gradients[0], &m, &v, 0.1, 1)
+	opt.Update(&expected, gradients[5], &m, &v, 0.1, 2)
+
+	assertFloatEqual(t, n.Weights()[0], float64(expected), "weight 0")
+	assertFloatEqual(t, s.firstMoments[0], float64(m), "first moment")
+	assertFloatEqual(t, s.secondMoments[0], float64(v), "second moment")
+}
+
+func TestApplySparseGradientsLazyL2(t *testing.T) {
+	reg := Regularization{L2: 0.1}
+	dense := newTestStorage(t, false, 1, 2, false).Node(0)
+	sparse := newTestStorage(t, true, 1, 2, false).Node(0)
+
+	// weight 0 only gets a gradient at the first and last iterations,
+	// so the decay of the iterations in between is applied lazily
+	gradients := map[int]mat.Float{0: 0.5, 4: -1}
+	for iter := 0; iter < 5; iter++ {
+		for _, n := range []Node{dense, sparse} {
+			if g, ok := gradients[iter]; ok {
+				n.accumulateGradient(0, g)
+			}
+			n.accumulateGradient(1, 0.25)
+		}
+		setSparseUpdates(t, false)
+		dense.ApplyGradients(optimizer.NewSGD(), 0.5, iter+1, reg)
+		setSparseUpdates(t, true)
+		sparse.ApplySparseGradients(optimizer.NewSGD(), 0.5, iter, reg)
+	}
+
+	for i, w := range dense.Weights() {
+		assertFloatEqual(t, sparse.Weights()[i], float64(w), "weight")
+	}
+	assertFloatEqual(t, sparse.Bias(), float64(dense.Bias()), "bias")
+}
+
+func TestApplyGradientsMaxNorm(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		n := newTestStorage(t, sparse, 1, 2, false).Node(0)
+		copy(n.Weights(), []mat.Float{3, 4})
+		reg := Regularization{MaxNorm: 1}
+
+		// weight 1 is not updated, but it is rescaled anyway
+		n.accumulateGradient(0, 0)
+		if sparse {
+			n.ApplySparseGradients(optimizer.NewSGD(), 0.1, 0, reg)
+		} else {
+			n.ApplyGradients(optimizer.NewSGD(), 0.1, 1, reg)
+		}
+		assertFloatEqual(t, n.Weights()[0], 0.6, "weight 0")
+		assertFloatEqual(t, n.Weights()[1], 0.8, "weight 1")
+
+		// the weights within the max norm are left unchanged
+		reg.MaxNorm = 2
+		n.accumulateGradient(0, 0)
+		if sparse {
+			n.ApplySparseGradients(optimizer.NewSGD(), 0.1, 1, reg)
+		} else {
+			n.ApplyGradients(optimizer.NewSGD(), 0.1, 2, reg)
+		}
+		assertFloatEqual(t, n.Weights()[0], 0.6, "weight 0")
+		assertFloatEqual(t, n.Weights()[1], 0.8, "weight 1")
+	}
+}
+
+func TestApplySparseGradientsMaxNorm(t *testing.T) {
+	reg := Regularization{MaxNorm: 2}
+	dense := newTestStorage(t, false, 2, 4, false)
+	sparse := newTestStorage(t, true, 2, 4, false)
+
+	// with SGD, the untouched weights do not change, so the norm kept
+	// up to date with the touched weights only is the same as the one
+	// of all the weights, also after a restore
+	touched := [][]int{{0}, {1, 3}, {}, {0, 2}, {3}, {1}}
+	var snapshot *Snapshot
+	for iter, indices := range touched {
+		if iter == 4 {
+			sparse.Restore(snapshot)
+			dense.Restore(snapshot)
+		}
+		for id := 0; id < 2; id++ {
+			for _, i := range indices {
+				dense.Node(id).accumulateGradient(i, mat.Float(i-id-1))
+				sparse.Node(id).accumulateGradient(i, mat.Float(i-id-1))
+			}
+			setSparseUpdates(t, false)
+			dense.Node(id).ApplyGradients(optimizer.NewSGD(), 0.5, iter+1, reg)
+			setSparseUpdates(t, true)
+			sparse.Node(id).ApplySparseGradients(optimizer.NewSGD(), 0.5, iter, reg)
+		}
+		if iter == 1 {
+			snapshot = sparse.Snapshot()
+		}
+	}
+
+	for id := 0; id < 2; id++ {
+		for i, w := range dense.Node(id).Weights() {
+			assertFloatEqual(t, sparse.Node(id).Weights()[i], float64(w), "weight")
+		}
+		assertFloatEqual(t, sparse.sparse.sqNorms[id],
+			float64(squaredNorm(sparse.Node(id).Weights())), "squared norm")
+	}
+}
+
+func TestApplySparseGradientsAdamWDecay(t *testing.T) {
+	s := newTestStorage(t, true, 1, 2, true)
+	n := s.Node(0)
+	opt := optimizer.NewAdamW(0.9, 0.999, 1e-8, 0.1)
+
+	// weight 0 is touched at iterations 0 and 3 only, so the decoupled
+	// weight decay of the two iterations in between is applied lazily,
+	// while the moments are not caught up
+	gradients := map[int]mat.Float{0: 0.5, 3: -2}
+	for iter := 0; iter < 4; iter++ {
+		if g, ok := gradients[iter]; ok {
+			n.accumulateGradient(0, g)
+		}
+		n.accumulateGradient(1, 1)
+		n.ApplySparseGradients(opt, 0.1, iter, Regularization{})
+	}
+
+	var expected, m, v mat.Float = 1, 0, 0
+	opt.Update(&expected, gradients[0], &m, &v, 0.1, 1)
+	expected *= mat.Pow(1-0.1*0.1, 2)
+	opt.Update(&expected, gradients[3], &m, &v, 0.1, 2)
+
+	assertFloatEqual(t, n.Weights()[0], float64(expected), "weight 0")
+	assertFloatEqual(t, s.firstMoments[0], float64(m), "first moment")
+	assertFloatEqual(t, s.secondMoments[0], float64(v), "second moment")
+}
+
+func TestBackPropagateDropoutScale(t *testing.T) {
+	previous := newTestStorage(t, true, 2, 1, false)
+	n := newTestStorage(t, true, 1, 2, false).Node(0)
+
+	// the previous layer activations were scaled by 2 by dropout,
+	// so the deltas they receive are scaled as well
+	previous.ResetExample(0, 2)
+	previous.Node(0).SetlastActivation(0, 0, 4)
+	previous.Node(1).SetlastActivation(0, 1, 4)
+	n.s.ResetExample(0, 1)
+	n.SetlastActivation(0, 0, 1)
+	n.IncrementDelta(0, 0, 0.5)
+
+	activeNodes := []index_value.Pair{{Index: 0, Value: 4}, {Index: 1, Value: 4}}
+	n.BackPropagate(previous, activeNodes, 2, 0, 0)
+
+	for slot := range activeNodes {
+		delta := -previous.Node(slot).GetGradient(0, 0, slot, 1)
+		assertFloatEqual(t, delta, 1, "previous layer delta")
+		assertFloatEqual(t, n.row(n.s.t)[slot], -2, "gradient")
+	}
+}
+
+// newTestStorage creates the storage of numNodes ReLU nodes with all
+// weights and biases set to 1, and moments if required.
+func newTestStorage(t *testing.T, sparse bool, numNodes, dim int, moments bool) *Storage {
+	setSparseUpdates(t, sparse)
+
+	weights := make([]mat.Float, numNodes*dim)
+	for i := range weights {
+		weights[i] = 1
+	}
+	bias := make([]mat.Float, numNodes)
+	for i := range bias {
+		bias[i] = 1
+	}
+
+	var firstMoments, secondMoments []mat.Float
+	if moments {
+		firstMoments = make([]mat.Float, numNodes*dim)
+		secondMoments = make([]mat.Float, numNodes*dim)
+	}
+	return NewStorage(ReLU, numNodes, dim, 2, weights, bias,
+		firstMoments, secondMoments)
+}
+
+// setSparseUpdates sets the global configuration for the duration of
+// the test.
+func setSparseUpdates(t *testing.T, sparse bool) {
+	previous := configuration.Global.SparseUpdates
+	configuration.Global.SparseUpdates = sparse
+	t.Cleanup(func() {
+		configuration.Global.SparseUpdates = previous
+	})
+}
+
+func assertIntSliceEqual(t *testing.T, actual, expected []int, msg string) {
+	if len(actual) != len(expected) {
+		t.Errorf("Assertion failed: %s | expected %v, actual %v",
+			msg, expected, actual)
+		return
+	}
+	for i := range actual {
+		if actual[i] != expected[i] {
+			t.Errorf("Assertion failed: %s | expected %v, actual %v",
+				msg, expected, actual)
+			return
+		}
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual mat.Float, expected float64, msg string) {
+	if math.Abs(float64(actual)-expected) > 1e-5 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
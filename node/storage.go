@@ -0,0 +1,260 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package node
+
+import (
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// Storage holds the parameters, the optimizer state and the per-example
+// training buffers of all the nodes of a layer in contiguous slices.
+//
+// The weights-sized slices are row-major matrices, with one row of
+// dim elements for each node.
+//
+// The activations and deltas of each example of the batch are kept only
+// for its active nodes, in the order of the active nodes list, and the
+// buffers are reused across batches. The position of an active node in
+// that list is its slot.
+type Storage struct {
+	nodeType NodeType
+	numNodes int
+	dim      int // number of weights of each node
+
+	weights       []mat.Float
+	firstMoments  []mat.Float // nil if not required by the optimizer
+	secondMoments []mat.Float // nil if not required by the optimizer
+	t             []mat.Float // accumulated gradients
+
+	bias             []mat.Float
+	tBias            []mat.Float
+	firstMomentBias  []mat.Float
+	secondMomentBias []mat.Float
+
+	sparse *sparseUpdates // nil for dense updates
+
+	examples []exampleBuffer // indexed by input ID
+}
+
+// exampleBuffer holds the activations and deltas of the active nodes
+// of a single example, indexed by slot.
+type exampleBuffer struct {
+	activations []mat.Float
+	deltas      []mat.Float
+}
+
+// sparseUpdates keeps track of the weights which received a gradient
+// during the current batch, so that only those are updated.
+type sparseUpdates struct {
+	touched     [][]int  // indices of touched weights of each node
+	touchedMask []uint64 // bitset of touched weights, maskWords per node
+	maskWords   int
+	steps       []int32 // number of updates of each weight
+	biasSteps   []int32 // number of updates of each bias
+	// iteration of the last update of each weight, allocated only
+	// when needed for L2 regularization or decoupled weight decay
+	lastIter []int32
+	// squared norm of the weights of each node, kept up to date by the
+	// updates, and allocated only when needed for the max-norm
+	// constraint
+	sqNorms []mat.Float
+}
+
+// Snapshot is a copy of the parameters and the optimizer state of
+// all the nodes of a Storage, which can be restored later.
+type Snapshot struct {
+	weights          []mat.Float
+	firstMoments     []mat.Float
+	secondMoments    []mat.Float
+	bias             []mat.Float
+	firstMomentBias  []mat.Float
+	secondMomentBias []mat.Float
+	steps            []int32
+	biasSteps        []int32
+	lastIter         []int32
+}
+
+// NewStorage creates the storage for numNodes nodes with dim weights
+// each. The given parameters and moments are used without copying
+// them; the moments are nil when not required by the optimizer.
+func NewStorage(
+	nodeType NodeType,
+	numNodes int,
+	dim int,
+	batchSize int,
+	weights []mat.Float,
+	bias []mat.Float,
+	firstMoments []mat.Float,
+	secondMoments []mat.Float,
+) *Storage {
+	s := &Storage{
+		nodeType:         nodeType,
+		numNodes:         numNodes,
+		dim:              dim,
+		weights:          weights,
+		firstMoments:     firstMoments,
+		secondMoments:    secondMoments,
+		t:                make([]mat.Float, numNodes*dim),
+		bias:             bias,
+		tBias:            make([]mat.Float, numNodes),
+		firstMomentBias:  make([]mat.Float, numNodes),
+		secondMomentBias: make([]mat.Float, numNodes),
+		sparse:           nil,
+		examples:         make([]exampleBuffer, batchSize),
+	}
+
+	if configuration.Global.SparseUpdates {
+		s.sparse = newSparseUpdates(numNodes, dim)
+	}
+
+	return s
+}
+
+func newSparseUpdates(numNodes, dim int) *sparseUpdates {
+	maskWords := (dim + 63) / 64
+	return &sparseUpdates{
+		touched:     make([][]int, numNodes),
+		touchedMask: make([]uint64, numNodes*maskWords),
+		maskWords:   maskWords,
+		steps:       make([]int32, numNodes*dim),
+		biasSteps:   make([]int32, numNodes),
+	}
+}
+
+func (s *sparseUpdates) touch(nodeId, i int) {
+	word := nodeId*s.maskWords + i/64
+	bit := uint64(1) << (i % 64)
+	if s.touchedMask[word]&bit == 0 {
+		s.touchedMask[word] |= bit
+		s.touched[nodeId] = append(s.touched[nodeId], i)
+	}
+}
+
+// Node returns a view of the node with the given ID.
+func (s *Storage) Node(id int) Node {
+	return Node{s: s, id: id}
+}
+
+func (s *Storage) NumNodes() int {
+	return s.numNodes
+}
+
+// BiasOnly returns a new storage with a copy of the biases only, for
+// nodes whose weights are kept elsewhere, as for quantized layers.
+// Its nodes have no weights, no optimizer state and no buffers: they
+// can only be used to get the bias and to apply the activation function,
+// as in QuantizedActivation.
+func (s *Storage) BiasOnly() *Storage {
+	return &Storage{
+		nodeType: s.nodeType,
+		numNodes: s.numNodes,
+		dim:      0,
+		bias:     copyFloatSlice(s.bias),
+	}
+}
+
+// ResetExample prepares the buffers of the given example of the batch
+// for numActive active nodes, discarding the previous values.
+func (s *Storage) ResetExample(inputId, numActive int) {
+	if inputId >= len(s.examples) {
+		panic("Input ID more than Batch Size")
+	}
+	b := &s.examples[inputId]
+	b.activations = resetFloatSlice(b.activations, numActive)
+	b.deltas = resetFloatSlice(b.deltas, numActive)
+}
+
+func (s *Storage) Snapshot() *Snapshot {
+	return s.SaveSnapshot(nil)
+}
+
+// SaveSnapshot copies the parameters and optimizer state of all nodes
+// into snapshot, reusing its buffers, or into a new one if nil, and
+// returns it.
+func (s *Storage) SaveSnapshot(snapshot *Snapshot) *Snapshot {
+	if snapshot == nil {
+		snapshot = &Snapshot{}
+	}
+	snapshot.weights = copyFloatSliceTo(snapshot.weights, s.weights)
+	snapshot.firstMoments = copyFloatSliceTo(snapshot.firstMoments, s.firstMoments)
+	snapshot.secondMoments = copyFloatSliceTo(snapshot.secondMoments, s.secondMoments)
+	snapshot.bias = copyFloatSliceTo(snapshot.bias, s.bias)
+	snapshot.firstMomentBias = copyFloatSliceTo(snapshot.firstMomentBias, s.firstMomentBias)
+	snapshot.secondMomentBias = copyFloatSliceTo(snapshot.secondMomentBias, s.secondMomentBias)
+	if s.sparse != nil {
+		snapshot.steps = copyInt32SliceTo(snapshot.steps, s.sparse.steps)
+		snapshot.biasSteps = copyInt32SliceTo(snapshot.biasSteps, s.sparse.biasSteps)
+		snapshot.lastIter = copyInt32SliceTo(snapshot.lastIter, s.sparse.lastIter)
+	}
+	return snapshot
+}
+
+// Restore sets the parameters and optimizer state of all nodes from
+// a snapshot of the same storage. Gradients are discarded.
+func (s *Storage) Restore(snapshot *Snapshot) {
+	for id := 0; id < s.numNodes; id++ {
+		s.Node(id).DiscardGradients()
+	}
+
+	copy(s.weights, snapshot.weights)
+	copy(s.firstMoments, snapshot.firstMoments)
+	copy(s.secondMoments, snapshot.secondMoments)
+	copy(s.bias, snapshot.bias)
+	copy(s.firstMomentBias, snapshot.firstMomentBias)
+	copy(s.secondMomentBias, snapshot.secondMomentBias)
+	if s.sparse != nil {
+		copy(s.sparse.steps, snapshot.steps)
+		copy(s.sparse.biasSteps, snapshot.biasSteps)
+		s.sparse.lastIter = copyInt32SliceTo(s.sparse.lastIter, snapshot.lastIter)
+		s.sparse.sqNorms = nil
+	}
+}
+
+// resetFloatSlice returns a slice of n zeros, reusing s if possible.
+func resetFloatSlice(s []mat.Float, n int) []mat.Float {
+	if cap(s) < n {
+		return make([]mat.Float, n)
+	}
+	s = s[:n]
+	for i := range s {
+		s[i] = 0
+	}
+	return s
+}
+
+func copyInt32Slice(s []int32) []int32 {
+	return copyInt32SliceTo(nil, s)
+}
+
+// copyInt32SliceTo returns a copy of src, reusing dst if possible.
+func copyInt32SliceTo(dst, src []int32) []int32 {
+	if src == nil {
+		return nil
+	}
+	if cap(dst) < len(src) {
+		dst = make([]int32, len(src))
+	}
+	dst = dst[:len(src)]
+	copy(dst, src)
+	return dst
+}
+
+func copyFloatSlice(s []mat.Float) []mat.Float {
+	return copyFloatSliceTo(nil, s)
+}
+
+// copyFloatSliceTo returns a copy of src, reusing dst if possible.
+func copyFloatSliceTo(dst, src []mat.Float) []mat.Float {
+	if src == nil {
+		return nil
+	}
+	if cap(dst) < len(src) {
+		dst = make([]mat.Float, len(src))
+	}
+	dst = dst[:len(src)]
+	copy(dst, src)
+	return dst
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package node
+
+import (
+	"testing"
+
+	"github.com/nlpodyssey/goslide/mat"
+	"github.com/nlpodyssey/goslide/optimizer"
+)
+
+func TestStorageNodeRows(t *testing.T) {
+	s := newTestStorage(t, true, 3, 2, false)
+	for i := range s.weights {
+		s.weights[i] = mat.Float(i)
+	}
+
+	for id := 0; id < 3; id++ {
+		n := s.Node(id)
+		assertIntEqual(t, n.Id(), id, "node ID")
+		assertIntEqual(t, len(n.Weights()), 2, "number of weights")
+		for i, w := range n.Weights() {
+			assertFloatEqual(t, w, float64(id*2+i), "weight")
+		}
+	}
+
+	// nodes are views of the storage
+	s.Node(1).Weights()[0] = 10
+	assertFloatEqual(t, s.weights[2], 10, "storage weight")
+}
+
+func TestStorageSnapshotRestore(t *testing.T) {
+	for _, sparse := range []bool{false, true} {
+		s := newTestStorage(t, sparse, 2, 3, true)
+		opt := optimizer.NewAdam(0.9, 0.999, 1e-8)
+		reg := Regularization{L2: 0.1}
+
+		update := func(iter int) {
+			for id := 0; id < s.NumNodes(); id++ {
+				n := s.Node(id)
+				n.accumulateGradient(iter%3, mat.Float(iter+1))
+				if sparse {
+					n.ApplySparseGradients(opt, 0.1, iter, reg)
+				} else {
+					n.ApplyGradients(opt, 0.1, iter+1, reg)
+				}
+			}
+		}
+
+		update(0)
+		snapshot := s.Snapshot()
+		expected := newTestStorage(t, sparse, 2, 3, true)
+		copyStorage(expected, s)
+
+		// pending gradients are discarded as well
+		update(1)
+		update(2)
+		s.Node(0).accumulateGradient(1, 5)
+		s.Restore(snapshot)
+
+		assertStorageEqual(t, s, expected)
+		if sparse {
+			assertIntEqual(t, len(s.sparse.touched[0]), 0, "touched weights")
+		}
+
+		// and the snapshot is not changed by later updates
+		update(1)
+		update(2)
+		s.Restore(snapshot)
+		assertStorageEqual(t, s, expected)
+	}
+}
+
+func TestStorageSaveSnapshot(t *testing.T) {
+	s := newTestStorage(t, true, 2, 3, true)
+	opt := optimizer.NewAdam(0.9, 0.999, 1e-8)
+	reg := Regularization{L2: 0.1}
+	snapshot := s.Snapshot()
+	weights := &snapshot.weights[0]
+
+	for id := 0; id < s.NumNodes(); id++ {
+		s.Node(id).accumulateGradient(1, 2)
+		s.Node(id).ApplySparseGradients(opt, 0.1, 0, reg)
+	}
+
+	// the buffers of the snapshot are reused
+	if s.SaveSnapshot(snapshot) != snapshot || &snapshot.weights[0] != weights {
+		t.Error("snapshot buffers not reused")
+	}
+	expected := newTestStorage(t, true, 2, 3, true)
+	copyStorage(expected, s)
+	s.Node(0).accumulateGradient(1, 5)
+	s.Node(0).ApplySparseGradients(opt, 0.1, 1, reg)
+	s.Restore(snapshot)
+	assertStorageEqual(t, s, expected)
+}
+
+func TestStorageExampleSlots(t *testing.T) {
+	s := newTestStorage(t, true, 4, 1, false)
+	s.ResetExample(0, 2)
+	s.ResetExample(1, 3)
+
+	// the activations are indexed by input ID and slot, not by node ID
+	s.Node(3).SetlastActivation(0, 0, 1)
+	s.Node(1).SetlastActivation(0, 1, 2)
+	s.Node(1).SetlastActivation(1, 2, 3)
+	s.Node(1).IncrementDelta(1, 2, 4)
+
+	assertFloatSliceEqual(t, s.examples[0].activations,
+		[]mat.Float{1, 2}, "activations of example 0")
+	assertFloatSliceEqual(t, s.examples[1].activations,
+		[]mat.Float{0, 0, 3}, "activations of example 1")
+	assertFloatSliceEqual(t, s.examples[0].deltas,
+		[]mat.Float{0, 0}, "deltas of example 0")
+	assertFloatSliceEqual(t, s.examples[1].deltas,
+		[]mat.Float{0, 0, 4}, "deltas of example 1")
+
+	assertPanics(t, "Input Not Active but still called", func() {
+		s.Node(0).GetLastActivation(0, 2)
+	})
+	assertPanics(t, "Input ID more than Batch Size", func() {
+		s.ResetExample(2, 1)
+	})
+}
+
+func TestStorageResetExample(t *testing.T) {
+	s := newTestStorage(t, true, 4, 1, false)
+	s.ResetExample(0, 3)
+	for slot := 0; slot < 3; slot++ {
+		s.Node(slot).SetlastActivation(0, slot, 1)
+		s.Node(slot).IncrementDelta(0, slot, 1)
+	}
+	activations := &s.examples[0].activations[0]
+	deltas := &s.examples[0].deltas[0]
+
+	// the buffers of the previous batch are reused, and zeroed
+	s.ResetExample(0, 2)
+	if &s.examples[0].activations[0] != activations ||
+		&s.examples[0].deltas[0] != deltas {
+		t.Error("buffers not reused")
+	}
+	assertFloatSliceEqual(t, s.examples[0].activations,
+		[]mat.Float{0, 0}, "activations")
+	assertFloatSliceEqual(t, s.examples[0].deltas,
+		[]mat.Float{0, 0}, "deltas")
+
+	// and they grow when needed
+	s.ResetExample(0, 4)
+	assertFloatSliceEqual(t, s.examples[0].activations,
+		[]mat.Float{0, 0, 0, 0}, "activations")
+	assertFloatSliceEqual(t, s.examples[0].deltas,
+		[]mat.Float{0, 0, 0, 0}, "deltas")
+}
+
+// copyStorage copies the parameters and the optimizer state of src
+// into dst, which must have the same shape.
+func copyStorage(dst, src *Storage) {
+	copy(dst.weights, src.weights)
+	copy(dst.firstMoments, src.firstMoments)
+	copy(dst.secondMoments, src.secondMoments)
+	copy(dst.bias, src.bias)
+	copy(dst.firstMomentBias, src.firstMomentBias)
+	copy(dst.secondMomentBias, src.secondMomentBias)
+	if src.sparse != nil {
+		copy(dst.sparse.steps, src.sparse.steps)
+		copy(dst.sparse.biasSteps, src.sparse.biasSteps)
+		dst.sparse.lastIter = copyInt32Slice(src.sparse.lastIter)
+	}
+}
+
+func assertStorageEqual(t *testing.T, actual, expected *Storage) {
+	assertFloatSliceEqual(t, actual.weights, expected.weights, "weights")
+	assertFloatSliceEqual(t, actual.firstMoments, expected.firstMoments,
+		"first moments")
+	assertFloatSliceEqual(t, actual.secondMoments, expected.secondMoments,
+		"second moments")
+	assertFloatSliceEqual(t, actual.t, expected.t, "gradients")
+	assertFloatSliceEqual(t, actual.bias, expected.bias, "bias")
+	assertFloatSliceEqual(t, actual.tBias, expected.tBias, "bias gradients")
+	assertFloatSliceEqual(t, actual.firstMomentBias,
+		expected.firstMomentBias, "bias first moments")
+	assertFloatSliceEqual(t, actual.secondMomentBias,
+		expected.secondMomentBias, "bias second moments")
+	if expected.sparse != nil {
+		assertInt32SliceEqual(t, actual.sparse.steps,
+			expected.sparse.steps, "steps")
+		assertInt32SliceEqual(t, actual.sparse.biasSteps,
+			expected.sparse.biasSteps, "bias steps")
+		assertInt32SliceEqual(t, actual.sparse.lastIter,
+			expected.sparse.lastIter, "last iterations")
+	}
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
+
+func assertFloatSliceEqual(t *testing.T, actual, expected []mat.Float, msg string) {
+	if len(actual) != len(expected) {
+		t.Errorf("Assertion failed: %s | expected %v, actual %v",
+			msg, expected, actual)
+		return
+	}
+	for i := range actual {
+		assertFloatEqual(t, actual[i], float64(expected[i]), msg)
+	}
+}
+
+func assertInt32SliceEqual(t *testing.T, actual, expected []int32, msg string) {
+	ints := func(s []int32) []int {
+		result := make([]int, len(s))
+		for i, v := range s {
+			result[i] = int(v)
+		}
+		return result
+	}
+	assertIntSliceEqual(t, ints(actual), ints(expected), msg)
+}
+
+func assertPanics(t *testing.T, expected string, fn func()) {
+	defer func() {
+		if r := recover(); r != expected {
+			t.Errorf("Assertion failed: expected panic %q, actual %v",
+				expected, r)
+		}
+	}()
+	fn()
+}
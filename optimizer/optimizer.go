@@ -0,0 +1,208 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Gradient-based optimization methods.
+//
+// An Optimizer does not own the parameters it updates, nor their
+// per-parameter state (moments): both are stored by the caller, which
+// allocates the moment vectors reported by Optimizer.Moments.
+package optimizer
+
+import (
+	"math"
+
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+type Optimizer interface {
+	// Moments reports which per-parameter moment vectors are required.
+	Moments() (first, second bool)
+
+	// Update changes param one step against the direction of grad.
+	// The moments m and v are updated in place, and they are nil when
+	// not required by the optimizer. step is the 1-based count of
+	// updates applied to the parameter, including the current one.
+	Update(param *mat.Float, grad mat.Float, m, v *mat.Float, lr mat.Float, step int)
+}
+
+// WeightDecayer is an Optimizer with decoupled weight decay, which
+// multiplies a parameter by 1 - lr*WeightDecay() at each update,
+// independently of the gradient.
+type WeightDecayer interface {
+	Optimizer
+	WeightDecay() mat.Float
+}
+
+type SGD struct{}
+
+var _ Optimizer = &SGD{}
+
+func NewSGD() *SGD {
+	return &SGD{}
+}
+
+func (o *SGD) Moments() (first, second bool) {
+	return false, false
+}
+
+func (o *SGD) Update(param *mat.Float, grad mat.Float, _, _ *mat.Float, lr mat.Float, _ int) {
+	*param -= lr * grad
+}
+
+type Momentum struct {
+	momentum mat.Float
+}
+
+var _ Optimizer = &Momentum{}
+
+func NewMomentum(momentum float64) *Momentum {
+	return &Momentum{momentum: mat.Float(momentum)}
+}
+
+func (o *Momentum) Moments() (first, second bool) {
+	return true, false
+}
+
+func (o *Momentum) Update(param *mat.Float, grad mat.Float, m, _ *mat.Float, lr mat.Float, _ int) {
+	*m = o.momentum*(*m) + grad
+	*param -= lr * (*m)
+}
+
+type AdaGrad struct {
+	eps mat.Float
+}
+
+var _ Optimizer = &AdaGrad{}
+
+func NewAdaGrad(eps float64) *AdaGrad {
+	return &AdaGrad{eps: mat.Float(eps)}
+}
+
+func (o *AdaGrad) Moments() (first, second bool) {
+	return false, true
+}
+
+func (o *AdaGrad) Update(param *mat.Float, grad mat.Float, _, v *mat.Float, lr mat.Float, _ int) {
+	*v += grad * grad
+	*param -= lr * grad / (mat.Sqrt(*v) + o.eps)
+}
+
+type RMSProp struct {
+	rho mat.Float
+	eps mat.Float
+}
+
+var _ Optimizer = &RMSProp{}
+
+func NewRMSProp(rho, eps float64) *RMSProp {
+	return &RMSProp{rho: mat.Float(rho), eps: mat.Float(eps)}
+}
+
+func (o *RMSProp) Moments() (first, second bool) {
+	return false, true
+}
+
+func (o *RMSProp) Update(param *mat.Float, grad mat.Float, _, v *mat.Float, lr mat.Float, _ int) {
+	*v = o.rho*(*v) + (1-o.rho)*grad*grad
+	*param -= lr * grad / (mat.Sqrt(*v) + o.eps)
+}
+
+type Adam struct {
+	beta1 mat.Float
+	beta2 mat.Float
+	eps   mat.Float
+
+	// bias correction factors indexed by step, computed once, up to
+	// the step from which they are 1
+	corrections []mat.Float
+}
+
+var _ Optimizer = &Adam{}
+
+// maxCorrections bounds the number of precomputed bias corrections,
+// for betas so close to 1 that the correction is never exactly 1.
+const maxCorrections = 1 << 16
+
+func NewAdam(beta1, beta2, eps float64) *Adam {
+	return &Adam{
+		beta1:       mat.Float(beta1),
+		beta2:       mat.Float(beta2),
+		eps:         mat.Float(eps),
+		corrections: biasCorrections(mat.Float(beta1), mat.Float(beta2)),
+	}
+}
+
+func (o *Adam) Moments() (first, second bool) {
+	return true, true
+}
+
+func (o *Adam) Update(param *mat.Float, grad mat.Float, m, v *mat.Float, lr mat.Float, step int) {
+	*m = o.beta1*(*m) + (1-o.beta1)*grad
+	*v = o.beta2*(*v) + (1-o.beta2)*grad*grad
+	*param -= lr * o.biasCorrection(step) * (*m) / (mat.Sqrt(*v) + o.eps)
+}
+
+// biasCorrection returns the correction for the given step without
+// modifying the optimizer, which is shared by all the parameters.
+func (o *Adam) biasCorrection(step int) mat.Float {
+	switch {
+	case step < len(o.corrections):
+		return o.corrections[step]
+	case len(o.corrections) < maxCorrections:
+		return 1
+	default:
+		return correction(o.beta1, o.beta2, step)
+	}
+}
+
+// biasCorrections returns the bias corrections of the steps before the
+// one from which both the powers of the betas are too small to change
+// the correction from 1.
+func biasCorrections(beta1, beta2 mat.Float) []mat.Float {
+	var corrections []mat.Float
+	for step := 0; step < maxCorrections; step++ {
+		if step > 0 && 1-math.Pow(float64(beta1), float64(step)) == 1 &&
+			1-math.Pow(float64(beta2), float64(step)) == 1 {
+			break
+		}
+		corrections = append(corrections, correction(beta1, beta2, step))
+	}
+	return corrections
+}
+
+func correction(beta1, beta2 mat.Float, step int) mat.Float {
+	s := float64(step)
+	return mat.Float(math.Sqrt(1-math.Pow(float64(beta2), s)) /
+		(1 - math.Pow(float64(beta1), s)))
+}
+
+// AdamW is Adam with decoupled weight decay.
+//
+// Algorithm from the paper:
+//
+//	Decoupled Weight Decay Regularization
+//	Ilya Loshchilov, Frank Hutter
+//	https://arxiv.org/abs/1711.05101
+type AdamW struct {
+	Adam
+	weightDecay mat.Float
+}
+
+var _ WeightDecayer = &AdamW{}
+
+func NewAdamW(beta1, beta2, eps, weightDecay float64) *AdamW {
+	return &AdamW{
+		Adam:        *NewAdam(beta1, beta2, eps),
+		weightDecay: mat.Float(weightDecay),
+	}
+}
+
+func (o *AdamW) WeightDecay() mat.Float {
+	return o.weightDecay
+}
+
+func (o *AdamW) Update(param *mat.Float, grad mat.Float, m, v *mat.Float, lr mat.Float, step int) {
+	*param -= lr * o.weightDecay * (*param)
+	o.Adam.Update(param, grad, m, v, lr, step)
+}
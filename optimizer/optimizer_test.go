@@ -0,0 +1,125 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package optimizer
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+func TestSGDUpdate(t *testing.T) {
+	o := NewSGD()
+	assertMoments(t, o, false, false)
+
+	var param mat.Float = 1
+	o.Update(&param, 2, nil, nil, 0.1, 1)
+	assertFloatEqual(t, param, 0.8, "param")
+}
+
+func TestMomentumUpdate(t *testing.T) {
+	o := NewMomentum(0.9)
+	assertMoments(t, o, true, false)
+
+	var param, m mat.Float = 1, 0
+
+	o.Update(&param, 2, &m, nil, 0.1, 1)
+	assertFloatEqual(t, m, 2, "m after first step")
+	assertFloatEqual(t, param, 0.8, "param after first step")
+
+	o.Update(&param, 2, &m, nil, 0.1, 2)
+	assertFloatEqual(t, m, 3.8, "m after second step")
+	assertFloatEqual(t, param, 0.42, "param after second step")
+}
+
+func TestAdaGradUpdate(t *testing.T) {
+	o := NewAdaGrad(0)
+	assertMoments(t, o, false, true)
+
+	var param, v mat.Float = 1, 0
+
+	o.Update(&param, 3, nil, &v, 0.1, 1)
+	assertFloatEqual(t, v, 9, "v after first step")
+	assertFloatEqual(t, param, 0.9, "param after first step")
+
+	o.Update(&param, 4, nil, &v, 0.1, 2)
+	assertFloatEqual(t, v, 25, "v after second step")
+	assertFloatEqual(t, param, 0.82, "param after second step")
+}
+
+func TestRMSPropUpdate(t *testing.T) {
+	o := NewRMSProp(0.75, 0)
+	assertMoments(t, o, false, true)
+
+	var param, v mat.Float = 1, 0
+
+	o.Update(&param, 2, nil, &v, 0.1, 1)
+	assertFloatEqual(t, v, 1, "v")
+	assertFloatEqual(t, param, 0.8, "param")
+}
+
+func TestAdamUpdate(t *testing.T) {
+	o := NewAdam(0.9, 0.999, 0)
+	assertMoments(t, o, true, true)
+
+	var param, m, v mat.Float = 1, 0, 0
+
+	// The first bias-corrected step always has magnitude lr.
+	o.Update(&param, 5, &m, &v, 0.1, 1)
+	assertFloatEqual(t, m, 0.5, "m")
+	assertFloatEqual(t, v, 0.025, "v")
+	assertFloatEqual(t, param, 0.9, "param")
+
+	param, m, v = 1.0, 0.0, 0.0
+	o.Update(&param, -5, &m, &v, 0.1, 1)
+	assertFloatEqual(t, param, 1.1, "param with negative gradient")
+}
+
+func TestAdamBiasCorrection(t *testing.T) {
+	assertBiasCorrections(t, 0.9, 0.999, 1, 2, 10, 1000, 40000, 1000000)
+
+	// the corrections of betas close to 1 are computed, not stored
+	assertBiasCorrections(t, 0.9, 0.9999, maxCorrections+10)
+}
+
+func TestAdamWUpdate(t *testing.T) {
+	o := NewAdamW(0.9, 0.999, 0, 0.5)
+	assertMoments(t, o, true, true)
+
+	var param, m, v mat.Float = 2, 0, 0
+
+	o.Update(&param, 5, &m, &v, 0.1, 1)
+	// decay: 2 - 0.1*0.5*2 = 1.9, then Adam step of magnitude lr
+	assertFloatEqual(t, param, 1.8, "param")
+}
+
+func assertBiasCorrections(t *testing.T, beta1, beta2 float64, steps ...int) {
+	o := NewAdam(beta1, beta2, 0)
+	// the betas as stored by the optimizer
+	b1, b2 := float64(mat.Float(beta1)), float64(mat.Float(beta2))
+	for _, step := range steps {
+		s := float64(step)
+		expected := math.Sqrt(1-math.Pow(b2, s)) / (1 - math.Pow(b1, s))
+		assertFloatEqual(t, o.biasCorrection(step), expected,
+			fmt.Sprintf("correction at step %d", step))
+	}
+}
+
+func assertMoments(t *testing.T, o Optimizer, first, second bool) {
+	f, s := o.Moments()
+	if f != first || s != second {
+		t.Errorf("Assertion failed: Moments | expected (%v, %v), actual (%v, %v)",
+			first, second, f, s)
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual mat.Float, expected float64, msg string) {
+	if math.Abs(float64(actual)-expected) > 1e-6 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
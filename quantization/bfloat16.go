@@ -0,0 +1,66 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantization
+
+import (
+	"math"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// BFloat16 is the "brain floating point" format: the 16 most significant
+// bits of a float32, keeping its exponent range with a 7 bit mantissa.
+type BFloat16 uint16
+
+const bfloat16NaN BFloat16 = 0x7FC0
+
+// NewBFloat16 converts a value to the nearest BFloat16, rounding
+// half to even.
+func NewBFloat16(f mat.Float) BFloat16 {
+	if math.IsNaN(float64(f)) {
+		return bfloat16NaN
+	}
+	bits := math.Float32bits(float32(f))
+	bits += 0x7FFF + (bits>>16)&1
+	return BFloat16(bits >> 16)
+}
+
+func (b BFloat16) Float() mat.Float {
+	return mat.Float(math.Float32frombits(uint32(b) << 16))
+}
+
+type BFloat16Vector struct {
+	values []BFloat16
+}
+
+var _ Vector = &BFloat16Vector{}
+
+// NewBFloat16Vector is a Quantizer converting each weight to BFloat16.
+func NewBFloat16Vector(weights []mat.Float) Vector {
+	values := make([]BFloat16, len(weights))
+	for i, w := range weights {
+		values[i] = NewBFloat16(w)
+	}
+	return &BFloat16Vector{values: values}
+}
+
+func (v *BFloat16Vector) Len() int {
+	return len(v.values)
+}
+
+func (v *BFloat16Vector) Dot(data []index_value.Pair) mat.Float {
+	var sum mat.Float = 0
+	for _, pair := range data {
+		sum += v.values[pair.Index].Float() * pair.Value
+	}
+	return sum
+}
+
+func (v *BFloat16Vector) HashValues(dst []mat.Float) {
+	for i, b := range v.values {
+		dst[i] = b.Float()
+	}
+}
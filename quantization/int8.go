@@ -0,0 +1,71 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantization
+
+import (
+	"math"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+const maxInt8Code = 127
+
+// Int8Vector stores symmetric 8 bit codes in [-127, 127], sharing a
+// single scale, so that each weight is approximated by code * scale.
+type Int8Vector struct {
+	codes []int8
+	scale mat.Float
+}
+
+var _ Vector = &Int8Vector{}
+
+// NewInt8Vector is a Quantizer mapping the weight with the largest
+// magnitude to ±127. Used per node, it results in per-neuron scales.
+func NewInt8Vector(weights []mat.Float) Vector {
+	var maxAbs float64
+	for _, w := range weights {
+		maxAbs = math.Max(maxAbs, math.Abs(float64(w)))
+	}
+
+	v := &Int8Vector{
+		codes: make([]int8, len(weights)),
+		scale: mat.Float(maxAbs / maxInt8Code),
+	}
+	if maxAbs == 0 || math.IsInf(maxAbs, 0) || math.IsNaN(maxAbs) {
+		return v
+	}
+
+	for i, w := range weights {
+		code := math.Round(float64(w) / maxAbs * maxInt8Code)
+		v.codes[i] = int8(math.Max(-maxInt8Code, math.Min(maxInt8Code, code)))
+	}
+	return v
+}
+
+func (v *Int8Vector) Len() int {
+	return len(v.codes)
+}
+
+func (v *Int8Vector) Scale() mat.Float {
+	return v.scale
+}
+
+func (v *Int8Vector) Dot(data []index_value.Pair) mat.Float {
+	var sum mat.Float = 0
+	for _, pair := range data {
+		sum += mat.Float(v.codes[pair.Index]) * pair.Value
+	}
+	return sum * v.scale
+}
+
+// HashValues writes the integer codes, without the scale: all the
+// hash functions only depend on the order or on the sign of the values,
+// which are not changed by a positive scale factor.
+func (v *Int8Vector) HashValues(dst []mat.Float) {
+	for i, c := range v.codes {
+		dst[i] = mat.Float(c)
+	}
+}
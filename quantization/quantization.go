@@ -0,0 +1,29 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Quantized representations of the weights of a trained network,
+// used for inference only.
+package quantization
+
+import (
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+// Vector is a quantized weights vector.
+type Vector interface {
+	// Len returns the number of elements of the vector.
+	Len() int
+
+	// Dot returns the dot product with a sparse vector.
+	Dot(data []index_value.Pair) mat.Float
+
+	// HashValues writes into dst the values to be hashed for LSH,
+	// which are proportional to the original weights, but not
+	// necessarily equal to them.
+	HashValues(dst []mat.Float)
+}
+
+// Quantizer converts a full-precision weights vector into a quantized one.
+type Quantizer func(weights []mat.Float) Vector
@@ -0,0 +1,79 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package quantization
+
+import (
+	"math"
+	"testing"
+
+	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
+)
+
+func TestBFloat16(t *testing.T) {
+	assertFloatEqual(t, NewBFloat16(1).Float(), 1, "1")
+	assertFloatEqual(t, NewBFloat16(-2.5).Float(), -2.5, "-2.5")
+	assertFloatEqual(t, NewBFloat16(0).Float(), 0, "0")
+
+	// 1 + 2^-8 is halfway between 1 and 1 + 2^-7: rounds to even
+	assertFloatEqual(t, NewBFloat16(1+1.0/256).Float(), 1, "half to even")
+	// 1 + 3 * 2^-8 is halfway between 1 + 2^-7 and 1 + 2^-6
+	assertFloatEqual(t, NewBFloat16(1+3.0/256).Float(), 1+1.0/64, "half to even up")
+
+	if f := NewBFloat16(mat.Float(math.NaN())).Float(); !math.IsNaN(float64(f)) {
+		t.Errorf("Assertion failed: NaN | actual %g", f)
+	}
+}
+
+func TestBFloat16Vector(t *testing.T) {
+	v := NewBFloat16Vector([]mat.Float{0.5, -1, 2})
+	assertIntEqual(t, v.Len(), 3, "Len")
+
+	dot := v.Dot([]index_value.Pair{{Index: 0, Value: 2}, {Index: 2, Value: 3}})
+	assertFloatEqual(t, dot, 7, "Dot")
+
+	values := make([]mat.Float, 3)
+	v.HashValues(values)
+	assertFloatEqual(t, values[1], -1, "HashValues")
+}
+
+func TestInt8Vector(t *testing.T) {
+	v := NewInt8Vector([]mat.Float{0.5, -1, 0.25, 0})
+	assertIntEqual(t, v.Len(), 4, "Len")
+
+	iv := v.(*Int8Vector)
+	assertFloatEqual(t, iv.Scale(), 1.0/127, "Scale")
+	expectedCodes := []int8{64, -127, 32, 0}
+	for i, c := range expectedCodes {
+		assertIntEqual(t, int(iv.codes[i]), int(c), "code")
+	}
+
+	dot := v.Dot([]index_value.Pair{{Index: 0, Value: 2}, {Index: 1, Value: 3}})
+	assertFloatEqual(t, dot, (64*2-127*3)/127.0, "Dot")
+
+	values := make([]mat.Float, 4)
+	v.HashValues(values)
+	assertFloatEqual(t, values[0], 64, "HashValues")
+}
+
+func TestInt8VectorZero(t *testing.T) {
+	v := NewInt8Vector([]mat.Float{0, 0}).(*Int8Vector)
+	assertFloatEqual(t, v.Scale(), 0, "Scale")
+	assertFloatEqual(t, v.Dot([]index_value.Pair{{Index: 1, Value: 5}}), 0, "Dot")
+}
+
+func assertIntEqual(t *testing.T, actual, expected int, msg string) {
+	if actual != expected {
+		t.Errorf("Assertion failed: %s | expected %d, actual %d",
+			msg, expected, actual)
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual mat.Float, expected float64, msg string) {
+	if math.Abs(float64(actual)-expected) > 1e-6 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
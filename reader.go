@@ -0,0 +1,432 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/dataset/csr"
+	"github.com/nlpodyssey/goslide/dataset/libsvm"
+	"github.com/nlpodyssey/goslide/dataset/xcrepo"
+)
+
+// openDataset opens the dataset files in the configured format. The
+// returned io.Closer must be closed once done with the reader.
+func openDataset(files configuration.DataFiles) (dataset.Reader, io.Closer) {
+	config := configuration.Global
+
+	filenames := expandDataFiles(files)
+	if len(filenames) > 1 {
+		return openShardedDataset(filenames)
+	}
+
+	filename := filenames[0]
+	_, file, compressed, err := openDataFile(filename)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if compressed {
+		file.Close()
+		return openShardedDataset(filenames)
+	}
+
+	numFeatures, numLabels := configuredDimensions()
+	reader := newReader(config.DataFormat, file, config.IndexBase,
+		config.BinaryLabels, numFeatures, numLabels)
+
+	if err := reader.Err(); err != nil {
+		logger.Fatalf("Error reading %s at line %d. %v",
+			filename, reader.LineNumber(), err)
+	}
+
+	var lenient *dataset.Lenient
+	if config.LenientParsing {
+		lenient = newLenient(reader.TotalPoints())
+		setLenient(reader, lenient, filename)
+	}
+	return reader, readerCloser{
+		reader:  reader,
+		file:    file,
+		name:    filename,
+		lenient: lenient,
+	}
+}
+
+// configuredDimensions returns the dimensions to read the data with,
+// which are zero if inferred.
+func configuredDimensions() (numFeatures, numLabels int) {
+	config := configuration.Global
+	if !config.InferDimensions {
+		numFeatures = config.InputDim
+		if len(config.SizesOfLayers) == config.NumLayer {
+			numLabels = numOutputs(config)
+		}
+	}
+	return numFeatures, numLabels
+}
+
+// resolveDimensions takes the number of records, the input dimension
+// and the size of the output layer omitted in the configuration from
+// the datasets, and checks the given ones against them.
+//
+// The last entry of SizesOfLayers is omitted by giving one less entry
+// than NumLayer, or zero.
+func resolveDimensions(trainData, testData dataset.Reader) {
+	config := configuration.Global
+
+	if len(config.SizesOfLayers) == config.NumLayer-1 {
+		config.SizesOfLayers = append(config.SizesOfLayers, 0)
+	}
+	if len(config.SizesOfLayers) != config.NumLayer {
+		logger.Fatalf("SizesOfLayers has %d entries, but NumLayer is %d.",
+			len(config.SizesOfLayers), config.NumLayer)
+	}
+	numOutputs := &config.SizesOfLayers[config.NumLayer-1]
+
+	// the dimensions inferred from LibSVM data are only the ones
+	// occurring in each file
+	check := exactDimension
+	if config.DataFormat == configuration.LibSVMDataFormat {
+		check = atLeastDimension
+	}
+
+	// fewer records than the dataset ones are the first records only
+	trainFiles, testFiles := config.TrainData.String(), config.TestData.String()
+	resolveDimension("TotRecords", &config.TotRecords,
+		trainFiles, trainData.TotalPoints(), atMostDimension)
+	resolveDimension("TotRecordsTest", &config.TotRecordsTest,
+		testFiles, testData.TotalPoints(), atMostDimension)
+	resolveDimension("InputDim", &config.InputDim,
+		trainFiles, trainData.NumFeatures(), check)
+	resolveDimension("InputDim", &config.InputDim,
+		testFiles, testData.NumFeatures(), check)
+	resolveDimension("The output layer size", numOutputs,
+		trainFiles, trainData.NumLabels(), check)
+	resolveDimension("The output layer size", numOutputs,
+		testFiles, testData.NumLabels(), check)
+}
+
+// dimensionCheck is how a dimension given in the configuration is
+// checked against the one of a dataset.
+type dimensionCheck int8
+
+const (
+	exactDimension   dimensionCheck = iota + 1 // equal to the dataset one
+	atLeastDimension                           // not less than the dataset one
+	atMostDimension                            // not greater than the dataset one
+)
+
+// resolveDimension sets the value, if not positive, to the one of the
+// dataset, or checks it against the dataset one.
+func resolveDimension(name string, value *int, filename string, actual int, check dimensionCheck) {
+	switch {
+	case actual <= 0:
+		if *value <= 0 {
+			logger.Fatalf("%s is required, since %s does not declare it.",
+				name, filename)
+		}
+	case *value <= 0:
+		*value = actual
+	case check == exactDimension && *value != actual,
+		check == atLeastDimension && *value < actual,
+		check == atMostDimension && *value > actual:
+		logger.Fatalf("%s is %d, but %s has %d.",
+			name, *value, filename, actual)
+	}
+}
+
+// quarantine is the shared quarantine file of all datasets, opened on
+// first use, and closed when the last dataset using it is closed.
+var quarantine *lockedWriter
+
+// lockedWriter serializes the writes of the readers of different
+// datasets, which can be prefetching at the same time.
+type lockedWriter struct {
+	mu    sync.Mutex
+	w     io.WriteCloser
+	users int
+}
+
+func (lw *lockedWriter) Write(p []byte) (int, error) {
+	lw.mu.Lock()
+	defer lw.mu.Unlock()
+	return lw.w.Write(p)
+}
+
+// newLenient creates the lenient parsing policy of a dataset with the
+// given total points, or zero if unknown, writing to the quarantine
+// file, if configured. Only the text formats support it.
+func newLenient(totalPoints int) *dataset.Lenient {
+	config := configuration.Global
+
+	if config.DataFormat == configuration.CSRDataFormat {
+		logger.Fatal("Lenient parsing requires the XCRepo or LibSVM data format.")
+	}
+
+	var w io.Writer
+	if config.QuarantineFile != "" {
+		if quarantine == nil {
+			file, err := os.Create(config.QuarantineFile)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			quarantine = &lockedWriter{w: file}
+		}
+		quarantine.users++
+		w = quarantine
+	}
+
+	return dataset.NewLenient(config.MaxErrorRate, totalPoints, w)
+}
+
+// releaseQuarantine closes the quarantine file, if configured, once
+// all the datasets using it are closed.
+func releaseQuarantine() error {
+	if quarantine == nil {
+		return nil
+	}
+	quarantine.users--
+	if quarantine.users > 0 {
+		return nil
+	}
+	err := quarantine.w.Close()
+	quarantine = nil
+	return err
+}
+
+// setLenient makes a reader of the named file in a text format skip
+// the malformed lines, with the given policy.
+func setLenient(reader dataset.Reader, lenient *dataset.Lenient, filename string) {
+	reader.(dataset.LenientReader).SetLenient(lenient, filename)
+}
+
+// readerCloser closes a reader, if needed, and then its file, if any,
+// logging the lines skipped by lenient parsing during the last pass.
+// If the reader is lenient, it releases the quarantine file as well.
+type readerCloser struct {
+	reader  dataset.Reader
+	file    io.Closer
+	name    string
+	lenient *dataset.Lenient
+}
+
+func (c readerCloser) Close() error {
+	if c.lenient != nil && c.lenient.NumSkipped() > 0 {
+		logger.Printf("Skipped %d malformed lines of %s:\n",
+			c.lenient.NumSkipped(), c.name)
+		for err, count := range c.lenient.Counts() {
+			logger.Printf("  %v: %d\n", err, count)
+		}
+	}
+
+	var err error
+	if closer, ok := c.reader.(io.Closer); ok {
+		err = closer.Close()
+	}
+	if c.file != nil {
+		if fileErr := c.file.Close(); err == nil {
+			err = fileErr
+		}
+	}
+	if c.lenient != nil {
+		if quarantineErr := releaseQuarantine(); err == nil {
+			err = quarantineErr
+		}
+	}
+	return err
+}
+
+// newReader creates a reader for the given format. The LibSVM format
+// requires the index base, whether the labels are binary, and the
+// dimensions, which are inferred if zero. The CSR format requires r to
+// be an *os.File.
+func newReader(
+	format configuration.DataFormatType,
+	r io.Reader,
+	indexBase int,
+	binaryLabels bool,
+	numFeatures, numLabels int,
+) dataset.Reader {
+	switch format {
+	case configuration.XCRepoDataFormat:
+		return xcrepo.NewScanner(r)
+	case configuration.LibSVMDataFormat:
+		if binaryLabels {
+			return libsvm.NewBinaryScanner(r, indexBase, numFeatures)
+		}
+		return libsvm.NewScanner(r, indexBase, numFeatures, numLabels)
+	case configuration.CSRDataFormat:
+		file, ok := r.(*os.File)
+		if !ok {
+			logger.Fatal("The CSR data format requires an uncompressed file.")
+		}
+		return csr.NewReader(file)
+	default:
+		logger.Fatalf("Unexpected data format %d.", format)
+		return nil
+	}
+}
+
+// prefetch starts reading batches of the dataset in the background,
+// up to maxBatches, or all if not positive.
+func prefetch(reader dataset.Reader, maxBatches int) *dataset.Prefetcher {
+	config := configuration.Global
+	return dataset.NewPrefetcher(context.Background(), reader,
+		config.BatchSize, maxBatches, config.PrefetchBatches)
+}
+
+// nextBatch returns the next prefetched batch, or nil if there are no
+// more batches.
+func nextBatch(batches *dataset.Prefetcher) []dataset.Example {
+	examples, ok := <-batches.Batches()
+	if ok {
+		return examples
+	}
+	fatalReadError(batches.Err())
+	return nil
+}
+
+// fatalReadError logs the error of reading a batch, if any, and exits.
+func fatalReadError(err error) {
+	var readErr *dataset.ReadError
+	if errors.As(err, &readErr) {
+		logger.Fatalf("Error at line %d. %v", readErr.LineNumber, readErr.Err)
+	} else if err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// batchReader reads the batches of a dataset.
+type batchReader interface {
+	// Next returns the next batch, or nil if there are no more batches.
+	Next() []dataset.Example
+	Close()
+}
+
+// trainingBatches reads the batches of the training data, up to
+// maxBatches, or all if not positive. The batches of a dataset in the
+// CSR format, even if permuted, are converted from its rows into the
+// memory of the previous batch; the others are prefetched.
+func trainingBatches(reader dataset.Reader, maxBatches int) batchReader {
+	var order []int
+	rows, ok := reader.(*csr.Reader)
+	if permuted, isPermuted := reader.(*dataset.PermutedReader); isPermuted {
+		order = permuted.Permutation()
+		rows, ok = permuted.Reader().(*csr.Reader)
+	}
+	if !ok {
+		return prefetchedBatches{prefetch(reader, maxBatches)}
+	}
+
+	end := rows.TotalPoints()
+	batchSize := configuration.Global.BatchSize
+	if maxBatches > 0 && maxBatches*batchSize < end {
+		end = maxBatches * batchSize
+	}
+	return &rowBatches{reader: rows, order: order, end: end}
+}
+
+// prefetchedBatches reads the batches prefetched in the background.
+type prefetchedBatches struct {
+	*dataset.Prefetcher
+}
+
+func (b prefetchedBatches) Next() []dataset.Example {
+	return nextBatch(b.Prefetcher)
+}
+
+// rowBatches reads the batches of a memory-mapped dataset in the CSR
+// format, in the given order of its examples, or sequentially if nil.
+type rowBatches struct {
+	reader   *csr.Reader
+	order    []int
+	position int
+	end      int
+	rows     []int // indices of the examples of the batch
+	batch    csr.Batch
+}
+
+func (b *rowBatches) Next() []dataset.Example {
+	end := b.position + configuration.Global.BatchSize
+	if end > b.end {
+		end = b.end
+	}
+	if b.position >= end {
+		return nil
+	}
+
+	b.rows = b.rows[:0]
+	for i := b.position; i < end; i++ {
+		if b.order != nil {
+			b.rows = append(b.rows, b.order[i])
+		} else {
+			b.rows = append(b.rows, i)
+		}
+	}
+	b.position = end
+
+	examples, err := b.reader.ReadBatch(&b.batch, b.rows)
+	fatalReadError(err)
+	return examples
+}
+
+func (b *rowBatches) Close() {}
+
+// shuffleDataset returns a reader of the given training data which
+// shuffles the examples at each epoch, as configured.
+func shuffleDataset(reader dataset.Reader) dataset.Reader {
+	config := configuration.Global
+	if config.Shuffle == configuration.NoShuffle {
+		return reader
+	}
+
+	seed := config.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	logger.Println("Shuffle seed", seed)
+
+	switch config.Shuffle {
+	case configuration.PermutationShuffle:
+		reader = dataset.NewPermutedReader(reader, seed)
+	case configuration.BufferShuffle:
+		reader = dataset.NewShuffleBufferReader(
+			reader, config.ShuffleBufferSize, seed)
+	default:
+		logger.Fatalf("Unexpected shuffle %d.", config.Shuffle)
+	}
+
+	if err := reader.Err(); err != nil {
+		logger.Fatalf("Error at line %d. %v", reader.LineNumber(), err)
+	}
+	return reader
+}
+
+// resetDataset restarts reading the dataset from the first example.
+func resetDataset(reader dataset.Reader) {
+	if err := reader.Reset(); err != nil {
+		logger.Fatal(err)
+	}
+}
+
+// resetEpoch restarts reading the training data, in the order of the
+// given epoch when it is shuffled.
+func resetEpoch(reader dataset.Reader, epoch int) {
+	shuffler, ok := reader.(dataset.Shuffler)
+	if !ok {
+		resetDataset(reader)
+		return
+	}
+	if err := shuffler.ResetEpoch(epoch); err != nil {
+		logger.Fatal(err)
+	}
+}
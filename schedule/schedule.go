@@ -0,0 +1,192 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Learning rate schedules.
+package schedule
+
+import "math"
+
+type Schedule interface {
+	// LearningRate returns the learning rate for the given
+	// 0-based training iteration (batch).
+	LearningRate(iter int) float64
+}
+
+// MetricObserver is implemented by schedules driven by evaluation
+// metrics, such as ReduceOnPlateau.
+type MetricObserver interface {
+	// Observe reports a new evaluation metric, where higher is better.
+	Observe(metric float64)
+}
+
+type Constant struct {
+	learningRate float64
+}
+
+var _ Schedule = &Constant{}
+
+func NewConstant(learningRate float64) *Constant {
+	return &Constant{learningRate: learningRate}
+}
+
+func (s *Constant) LearningRate(int) float64 {
+	return s.learningRate
+}
+
+// StepDecay multiplies the learning rate by decayRate
+// every decaySteps iterations.
+type StepDecay struct {
+	learningRate float64
+	decayRate    float64
+	decaySteps   int
+}
+
+var _ Schedule = &StepDecay{}
+
+func NewStepDecay(learningRate, decayRate float64, decaySteps int) *StepDecay {
+	return &StepDecay{
+		learningRate: learningRate,
+		decayRate:    decayRate,
+		decaySteps:   decaySteps,
+	}
+}
+
+func (s *StepDecay) LearningRate(iter int) float64 {
+	return s.learningRate *
+		math.Pow(s.decayRate, float64(iter/s.decaySteps))
+}
+
+// Exponential continuously decays the learning rate, so that it is
+// multiplied by decayRate every decaySteps iterations.
+type Exponential struct {
+	learningRate float64
+	decayRate    float64
+	decaySteps   int
+}
+
+var _ Schedule = &Exponential{}
+
+func NewExponential(learningRate, decayRate float64, decaySteps int) *Exponential {
+	return &Exponential{
+		learningRate: learningRate,
+		decayRate:    decayRate,
+		decaySteps:   decaySteps,
+	}
+}
+
+func (s *Exponential) LearningRate(iter int) float64 {
+	return s.learningRate *
+		math.Pow(s.decayRate, float64(iter)/float64(s.decaySteps))
+}
+
+// CosineAnnealing decreases the learning rate from its initial value
+// down to minLearningRate along half a cosine period of the given
+// length, then keeps it at minLearningRate.
+type CosineAnnealing struct {
+	learningRate    float64
+	minLearningRate float64
+	period          int
+}
+
+var _ Schedule = &CosineAnnealing{}
+
+func NewCosineAnnealing(learningRate, minLearningRate float64, period int) *CosineAnnealing {
+	return &CosineAnnealing{
+		learningRate:    learningRate,
+		minLearningRate: minLearningRate,
+		period:          period,
+	}
+}
+
+func (s *CosineAnnealing) LearningRate(iter int) float64 {
+	if iter >= s.period {
+		return s.minLearningRate
+	}
+	progress := float64(iter) / float64(s.period)
+	return s.minLearningRate + (s.learningRate-s.minLearningRate)*
+		(1+math.Cos(math.Pi*progress))/2
+}
+
+// LinearWarmup linearly scales up the learning rate of another schedule
+// during the first warmupSteps iterations.
+type LinearWarmup struct {
+	schedule    Schedule
+	warmupSteps int
+}
+
+var _ Schedule = &LinearWarmup{}
+var _ MetricObserver = &LinearWarmup{}
+
+func NewLinearWarmup(schedule Schedule, warmupSteps int) *LinearWarmup {
+	return &LinearWarmup{
+		schedule:    schedule,
+		warmupSteps: warmupSteps,
+	}
+}
+
+func (s *LinearWarmup) LearningRate(iter int) float64 {
+	lr := s.schedule.LearningRate(iter)
+	if iter < s.warmupSteps {
+		return lr * float64(iter+1) / float64(s.warmupSteps)
+	}
+	return lr
+}
+
+// Observe forwards the metric to the wrapped schedule, if it is
+// a MetricObserver.
+func (s *LinearWarmup) Observe(metric float64) {
+	if o, ok := s.schedule.(MetricObserver); ok {
+		o.Observe(metric)
+	}
+}
+
+// ReduceOnPlateau multiplies the learning rate by decayRate each time
+// the observed metric does not improve for more than patience
+// consecutive observations, without going below minLearningRate.
+type ReduceOnPlateau struct {
+	learningRate    float64
+	decayRate       float64
+	minLearningRate float64
+	patience        int
+	best            float64
+	numBadMetrics   int
+}
+
+var _ Schedule = &ReduceOnPlateau{}
+var _ MetricObserver = &ReduceOnPlateau{}
+
+func NewReduceOnPlateau(
+	learningRate float64,
+	decayRate float64,
+	minLearningRate float64,
+	patience int,
+) *ReduceOnPlateau {
+	return &ReduceOnPlateau{
+		learningRate:    learningRate,
+		decayRate:       decayRate,
+		minLearningRate: minLearningRate,
+		patience:        patience,
+		best:            math.Inf(-1),
+		numBadMetrics:   0,
+	}
+}
+
+func (s *ReduceOnPlateau) LearningRate(int) float64 {
+	return s.learningRate
+}
+
+func (s *ReduceOnPlateau) Observe(metric float64) {
+	if metric > s.best {
+		s.best = metric
+		s.numBadMetrics = 0
+		return
+	}
+
+	s.numBadMetrics++
+	if s.numBadMetrics > s.patience {
+		s.learningRate = math.Max(
+			s.learningRate*s.decayRate, s.minLearningRate)
+		s.numBadMetrics = 0
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package schedule
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestConstant(t *testing.T) {
+	s := NewConstant(0.1)
+	assertLearningRates(t, s, map[int]float64{0: 0.1, 1: 0.1, 1000: 0.1})
+}
+
+func TestStepDecay(t *testing.T) {
+	s := NewStepDecay(0.1, 0.5, 10)
+	assertLearningRates(t, s, map[int]float64{
+		0:  0.1,
+		9:  0.1,
+		10: 0.05,
+		25: 0.025,
+	})
+}
+
+func TestExponential(t *testing.T) {
+	s := NewExponential(0.1, 0.5, 10)
+	assertLearningRates(t, s, map[int]float64{
+		0:  0.1,
+		5:  0.1 * math.Sqrt(0.5),
+		10: 0.05,
+		20: 0.025,
+	})
+}
+
+func TestCosineAnnealing(t *testing.T) {
+	s := NewCosineAnnealing(0.1, 0.02, 100)
+	assertLearningRates(t, s, map[int]float64{
+		0:   0.1,
+		50:  0.06,
+		100: 0.02,
+		500: 0.02,
+	})
+}
+
+func TestLinearWarmup(t *testing.T) {
+	s := NewLinearWarmup(NewStepDecay(0.1, 0.5, 10), 4)
+	assertLearningRates(t, s, map[int]float64{
+		0:  0.025,
+		1:  0.05,
+		3:  0.1,
+		4:  0.1,
+		10: 0.05,
+	})
+}
+
+func TestReduceOnPlateau(t *testing.T) {
+	s := NewReduceOnPlateau(0.1, 0.5, 0.03, 1)
+
+	for i, step := range []struct {
+		metric   float64
+		expected float64
+	}{
+		{0.5, 0.1},
+		{0.6, 0.1},
+		{0.6, 0.1},   // first bad metric, within patience
+		{0.55, 0.05}, // second bad metric
+		{0.7, 0.05},
+		{0.1, 0.05},
+		{0.2, 0.03}, // clipped to the minimum
+		{0.2, 0.03},
+		{0.2, 0.03},
+	} {
+		s.Observe(step.metric)
+		assertFloatEqual(t, s.LearningRate(i), step.expected,
+			fmt.Sprintf("observation %d", i))
+	}
+}
+
+func TestLinearWarmupForwardsObservations(t *testing.T) {
+	s := NewLinearWarmup(NewReduceOnPlateau(0.1, 0.5, 0, 0), 2)
+	s.Observe(1)
+	s.Observe(0)
+	assertFloatEqual(t, s.LearningRate(10), 0.05, "learning rate")
+}
+
+func assertLearningRates(t *testing.T, s Schedule, expected map[int]float64) {
+	for iter, lr := range expected {
+		assertFloatEqual(t, s.LearningRate(iter), lr,
+			fmt.Sprintf("LearningRate(%d)", iter))
+	}
+}
+
+func assertFloatEqual(t *testing.T, actual, expected float64, msg string) {
+	if math.Abs(actual-expected) > 1e-9 {
+		t.Errorf("Assertion failed: %s | expected %g, actual %g",
+			msg, expected, actual)
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2020, The GoSLIDE Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/nlpodyssey/goslide/configuration"
+	"github.com/nlpodyssey/goslide/dataset"
+	"github.com/nlpodyssey/goslide/dataset/libsvm"
+	"github.com/nlpodyssey/goslide/dataset/xcrepo"
+)
+
+// expandDataFiles returns the files matching the patterns, in order.
+func expandDataFiles(files configuration.DataFiles) []string {
+	if len(files) == 0 {
+		logger.Fatal("No data files given.")
+	}
+
+	var filenames []string
+	for _, pattern := range files {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if len(matches) == 0 {
+			logger.Fatalf("No data files match %s.", pattern)
+		}
+		filenames = append(filenames, matches...)
+	}
+	return filenames
+}
+
+// openDataFile opens a data file, decompressing it if needed. The file
+// must be closed once done with the returned reader.
+func openDataFile(filename string) (io.Reader, *os.File, bool, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	r, compressed, err := dataset.Decompress(file)
+	if err != nil {
+		file.Close()
+		return nil, nil, false, err
+	}
+	return r, file, compressed, nil
+}
+
+// openShardedDataset opens a dataset split in several files, or
+// compressed, whose files are read in sequence, and opened again at
+// each pass.
+func openShardedDataset(filenames []string) (dataset.Reader, io.Closer) {
+	config := configuration.Global
+
+	numFeatures, numLabels := configuredDimensions()
+	totalPoints, numFeatures, numLabels :=
+		shardDimensions(filenames, numFeatures, numLabels)
+
+	var lenient *dataset.Lenient
+	if config.LenientParsing {
+		lenient = newLenient(totalPoints)
+	}
+
+	globalHeader := config.DataFormat == configuration.XCRepoDataFormat &&
+		config.ShardHeader == configuration.GlobalShardHeader
+
+	open := func(shard int) (dataset.Reader, io.Closer, error) {
+		r, file, _, err := openDataFile(filenames[shard])
+		if err != nil {
+			return nil, nil, err
+		}
+
+		var reader dataset.Reader
+		if globalHeader && shard > 0 {
+			reader = xcrepo.NewHeaderlessScanner(r, numFeatures, numLabels)
+		} else {
+			reader = newReader(config.DataFormat, r, config.IndexBase,
+				config.BinaryLabels, numFeatures, numLabels)
+		}
+
+		if lenient != nil {
+			if shard == 0 {
+				lenient.Reset() // a new pass
+			}
+			setLenient(reader, lenient, filenames[shard])
+		}
+		return reader, readerCloser{reader: reader, file: file}, nil
+	}
+
+	reader := dataset.NewShardedReader(
+		filenames, open, totalPoints, numFeatures, numLabels)
+	return reader, readerCloser{
+		reader:  reader,
+		name:    configuration.DataFiles(filenames).String(),
+		lenient: lenient,
+	}
+}
+
+// shardDimensions returns the total points and the dimensions of a
+// sharded dataset, from the headers of the shards. The dimensions of
+// the LibSVM format are the given ones, or inferred reading all the
+// data if not positive.
+func shardDimensions(filenames []string, numFeatures, numLabels int) (int, int, int) {
+	config := configuration.Global
+
+	switch {
+	case config.DataFormat == configuration.LibSVMDataFormat:
+		return inferShardDimensions(filenames, numFeatures, numLabels)
+	case config.DataFormat == configuration.XCRepoDataFormat &&
+		config.ShardHeader == configuration.GlobalShardHeader:
+		filenames = filenames[:1]
+	}
+
+	totalPoints := 0
+	for i, filename := range filenames {
+		r, file, _, err := openDataFile(filename)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		reader := newReader(config.DataFormat, r, config.IndexBase,
+			config.BinaryLabels, 0, 0)
+		if err := reader.Err(); err != nil {
+			logger.Fatalf("Error reading %s at line %d. %v",
+				filename, reader.LineNumber(), err)
+		}
+
+		if i == 0 {
+			numFeatures, numLabels = reader.NumFeatures(), reader.NumLabels()
+		} else if reader.NumFeatures() != numFeatures ||
+			reader.NumLabels() != numLabels {
+			logger.Fatalf("%s has %d features and %d labels, but %s has %d and %d.",
+				filename, reader.NumFeatures(), reader.NumLabels(),
+				filenames[0], numFeatures, numLabels)
+		}
+		totalPoints += reader.TotalPoints()
+
+		readerCloser{reader: reader, file: file}.Close()
+	}
+	return totalPoints, numFeatures, numLabels
+}
+
+// inferShardDimensions returns the total points and the dimensions of a
+// sharded dataset in the LibSVM format, reading all the data, unless
+// the dimensions are given.
+func inferShardDimensions(filenames []string, numFeatures, numLabels int) (int, int, int) {
+	config := configuration.Global
+	if numFeatures > 0 && numLabels > 0 {
+		return 0, numFeatures, numLabels
+	}
+
+	totalPoints, maxFeature, maxLabel := 0, -1, -1
+	for _, filename := range filenames {
+		r, file, _, err := openDataFile(filename)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		// the bounds are checked, and the malformed lines reported or
+		// skipped, when reading the data again
+		var reader *libsvm.Scanner
+		if config.BinaryLabels {
+			reader = libsvm.NewBinaryScanner(r, config.IndexBase, math.MaxInt32)
+		} else {
+			reader = libsvm.NewScanner(
+				r, config.IndexBase, math.MaxInt32, math.MaxInt32)
+		}
+		reader.SetLenient(dataset.NewLenient(1, 0, nil), filename)
+		for reader.Scan() {
+			totalPoints++
+			for _, feature := range reader.Example().Features {
+				if feature.Index > maxFeature {
+					maxFeature = feature.Index
+				}
+			}
+			for _, label := range reader.Example().Labels {
+				if label > maxLabel {
+					maxLabel = label
+				}
+			}
+		}
+		if err := reader.Err(); err != nil {
+			logger.Fatalf("Error reading %s at line %d. %v",
+				filename, reader.LineNumber(), err)
+		}
+		file.Close()
+	}
+
+	if numFeatures <= 0 {
+		numFeatures = maxFeature + 1
+	}
+	if numLabels <= 0 {
+		numLabels = maxLabel + 1
+	}
+	return totalPoints, numFeatures, numLabels
+}
@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 type SparseRandomProjection struct {
@@ -57,12 +58,12 @@ func New(dimension, numOfHashes, ratio int) *SparseRandomProjection {
 	}
 }
 
-func (srp *SparseRandomProjection) GetHash(vector []float64) []int {
+func (srp *SparseRandomProjection) GetHash(vector []mat.Float) []int {
 	hashes := make([]int, srp.numHashes)
 
 	// TODO: parallel?
 	for i := range hashes {
-		s := 0.0
+		var s mat.Float = 0
 		for j, rb := range srp.randBits[i] {
 			v := vector[srp.indices[i][j]]
 			if rb {
@@ -89,7 +90,7 @@ func (srp *SparseRandomProjection) GetHashSparse(
 	hashes := make([]int, srp.numHashes)
 
 	for p := range hashes {
-		s := 0.0
+		var s mat.Float = 0
 
 		for i, j := 0, 0; i < length && j < srp.samSize; {
 			if data[i].Index == srp.indices[p][j] {
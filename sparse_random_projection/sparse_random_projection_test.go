@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 func TestSparseRandomProjectionNew(t *testing.T) {
@@ -36,7 +37,7 @@ func TestSparseRandomProjectionNew(t *testing.T) {
 func TestSparseRandomProjectionGetHash(t *testing.T) {
 	// Just ensure no error is raised
 	h := New(10, 3, 2)
-	result := h.GetHash([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	result := h.GetHash([]mat.Float{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
 	assertIntEqual(t, len(result), 3, "len(result)")
 }
 
@@ -16,6 +16,7 @@ import (
 	"time"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 // The number of times the range is larger than
@@ -61,7 +62,7 @@ func New(numHashes, numOfBitsToHash int) *WtaHash {
 
 func (wh *WtaHash) GetHash(data []index_value.Pair) []int {
 	hashes := make([]int, wh.numHashes)
-	values := make([]float64, wh.numHashes)
+	values := make([]mat.Float, wh.numHashes)
 
 	for i := 0; i < wh.numHashes; i++ {
 		hashes[i] = math.MinInt64
@@ -86,9 +87,9 @@ func (wh *WtaHash) GetHash(data []index_value.Pair) []int {
 }
 
 // TODO: avoid code duplication
-func (wh *WtaHash) GetHashDense(data []float64) []int {
+func (wh *WtaHash) GetHashDense(data []mat.Float) []int {
 	hashes := make([]int, wh.numHashes)
-	values := make([]float64, wh.numHashes)
+	values := make([]mat.Float, wh.numHashes)
 
 	for i := 0; i < wh.numHashes; i++ {
 		hashes[i] = math.MinInt64
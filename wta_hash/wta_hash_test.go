@@ -8,6 +8,7 @@ import (
 	"testing"
 
 	"github.com/nlpodyssey/goslide/index_value"
+	"github.com/nlpodyssey/goslide/mat"
 )
 
 func TestWtaHashNew(t *testing.T) {
@@ -65,11 +66,11 @@ func TestWtaHashGetHash(t *testing.T) {
 func TestWtaHashGetHashDense(t *testing.T) {
 	h := New(3, 10)
 
-	a := h.GetHashDense([]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
-	b := h.GetHashDense([]float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100})
+	a := h.GetHashDense([]mat.Float{1, 2, 3, 4, 5, 6, 7, 8, 9, 10})
+	b := h.GetHashDense([]mat.Float{10, 20, 30, 40, 50, 60, 70, 80, 90, 100})
 	assertIntSliceEqual(t, a, b, "a and b must be the same")
 
-	c := h.GetHashDense([]float64{10, 9, 8, 7, 6, 5, 4, 3, 2, 1})
+	c := h.GetHashDense([]mat.Float{10, 9, 8, 7, 6, 5, 4, 3, 2, 1})
 	assertIntSliceNotEqual(t, a, c, "a and c must differ")
 }
 